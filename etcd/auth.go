@@ -0,0 +1,152 @@
+package etcd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// User is a user of the v2 auth API.
+type User struct {
+	User  string `json:"user"`
+	Roles []Role `json:"roles,omitempty"`
+}
+
+// Role is a role of the v2 auth API.
+type Role struct {
+	Role        string      `json:"role"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type Permissions struct {
+	KV RWPermission `json:"kv"`
+}
+
+// RWPermission lists the key patterns a role may read and write.
+type RWPermission struct {
+	Read  []string `json:"read"`
+	Write []string `json:"write"`
+}
+
+// ListUsers returns the names of all the users known to the cluster.
+// It requires root access if auth is enabled.
+func (c *Client) ListUsers() ([]string, error) {
+	var collection struct {
+		Users []json.RawMessage `json:"users"`
+	}
+	if err := c.getAuth("users", &collection); err != nil {
+		return nil, err
+	}
+
+	// etcd 2.3 and later describe each user with an object,
+	// while earlier versions only list their names.
+	names := make([]string, 0, len(collection.Users))
+	for _, raw := range collection.Users {
+		var user User
+		if err := json.Unmarshal(raw, &user.User); err != nil {
+			if err := json.Unmarshal(raw, &user); err != nil {
+				return nil, err
+			}
+		}
+		names = append(names, user.User)
+	}
+
+	return names, nil
+}
+
+// ListRoles returns the names of all the roles known to the cluster.
+// It requires root access if auth is enabled.
+func (c *Client) ListRoles() ([]string, error) {
+	var collection struct {
+		Roles []json.RawMessage `json:"roles"`
+	}
+	if err := c.getAuth("roles", &collection); err != nil {
+		return nil, err
+	}
+
+	// etcd 2.3 and later describe each role with an object,
+	// while earlier versions only list their names.
+	names := make([]string, 0, len(collection.Roles))
+	for _, raw := range collection.Roles {
+		var role Role
+		if err := json.Unmarshal(raw, &role.Role); err != nil {
+			if err := json.Unmarshal(raw, &role); err != nil {
+				return nil, err
+			}
+		}
+		names = append(names, role.Role)
+	}
+
+	return names, nil
+}
+
+// getAuth issues a GET request against the auth API and decodes
+// the response into v
+func (c *Client) getAuth(name string, v interface{}) error {
+	logger.Debugf("auth %s [%s]", name, c.cluster.Leader)
+
+	req := NewRawRequest("GET", path.Join("auth", name), nil, nil)
+	raw, err := c.SendRequest(req)
+	if err != nil {
+		return err
+	}
+
+	if raw.StatusCode != http.StatusOK {
+		return handleError(raw.Body)
+	}
+
+	return json.Unmarshal(raw.Body, v)
+}
+
+// allowsWrite reports whether the auth of the cluster, if enabled, lets
+// the user of the leader URL, or the guest role without one, write the
+// given key. Since users may not be allowed to read their own roles,
+// true is returned if they cannot be read.
+func (c *Client) allowsWrite(key string) bool {
+	var enabled struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.getAuth("enable", &enabled); err != nil || !enabled.Enabled {
+		return true
+	}
+
+	var roles []Role
+	if user := leaderUser(c.cluster.Leader); user == "root" {
+		return true
+	} else if user != "" {
+		var u User
+		if err := c.getAuth(path.Join("users", user), &u); err != nil {
+			logger.Debug("auth.user unknown: ", err)
+			return true
+		}
+		roles = u.Roles
+	} else {
+		var guest Role
+		if err := c.getAuth(path.Join("roles", "guest"), &guest); err != nil {
+			logger.Debug("auth.guest unknown: ", err)
+			return true
+		}
+		roles = []Role{guest}
+	}
+
+	for _, role := range roles {
+		for _, pattern := range role.Permissions.KV.Write {
+			if pattern == key || strings.HasSuffix(pattern, "*") &&
+				strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// leaderUser returns the name of the user in the given machine URL, if any.
+func leaderUser(machine string) string {
+	u, err := url.Parse(machine)
+	if err != nil || u.User == nil {
+		return ""
+	}
+	return u.User.Username()
+}
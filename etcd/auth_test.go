@@ -0,0 +1,95 @@
+package etcd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestListUsersAndRoles(t *testing.T) {
+	for _, body := range []string{
+		// etcd 2.3 and later
+		`{"users":[{"user":"root","roles":[{"role":"root"}]},{"user":"alice"}],
+		  "roles":[{"role":"root","permissions":{"kv":{"read":["/*"],"write":["/*"]}}},{"role":"guest"}]}`,
+		// earlier versions
+		`{"users":["root","alice"],"roles":["root","guest"]}`,
+	} {
+		var paths []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			w.Write([]byte(body))
+		}))
+
+		c := NewClient([]string{ts.URL})
+
+		users, err := c.ListUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(users, []string{"root", "alice"}) {
+			t.Fatalf("ListUsers failed: %v", users)
+		}
+
+		roles, err := c.ListRoles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(roles, []string{"root", "guest"}) {
+			t.Fatalf("ListRoles failed: %v", roles)
+		}
+
+		if !reflect.DeepEqual(paths, []string{"/v2/auth/users", "/v2/auth/roles"}) {
+			t.Fatalf("unexpected request paths: %v", paths)
+		}
+
+		ts.Close()
+	}
+}
+
+func TestCanWriteAuth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/auth/enable":
+			w.Write([]byte(`{"enabled":true}`))
+		case "/v2/auth/users/alice":
+			w.Write([]byte(`{"user":"alice","roles":[
+				{"role":"app","permissions":{"kv":{"read":["/*"],"write":["/app/*","/shared"]}}}]}`))
+		case "/v2/auth/roles/guest":
+			w.Write([]byte(`{"role":"guest","permissions":{"kv":{"read":["/*"],"write":[]}}}`))
+		default:
+			// the keys do not exist yet
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":100,"message":"Key not found","index":1}`))
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword("alice", "pass")
+	c := NewClient([]string{u.String()})
+
+	for key, expected := range map[string]bool{
+		"app/config": true,
+		"shared":     true,
+		"other/key":  false,
+	} {
+		ok, err := c.CanWrite(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Errorf("CanWrite(%q) = %v for alice, expected %v", key, ok, expected)
+		}
+	}
+
+	// The guest may not write at all
+	c = NewClient([]string{ts.URL})
+	if ok, err := c.CanWrite("app/config"); ok || err != nil {
+		t.Errorf("CanWrite = %v, %v for the guest, expected false", ok, err)
+	}
+}
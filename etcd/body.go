@@ -0,0 +1,40 @@
+package etcd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// MaxPooledBodyBytes is the size up to which the buffers used to read
+// response bodies are kept for reuse. Buffers which grew larger, to read
+// a big tree, are left to the garbage collector, so that the pool does
+// not pin them. Zero disables the reuse.
+var MaxPooledBodyBytes = 64 * 1024
+
+var bodyBuffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// readBody reads r to the end, like ioutil.ReadAll, into a pooled buffer.
+// The returned bytes are a copy of its content and never shared, since
+// the bodies are handed out with RawResponse.Body.
+func readBody(r io.Reader) ([]byte, error) {
+	buf := bodyBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= MaxPooledBodyBytes {
+			bodyBuffers.Put(buf)
+		}
+	}()
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, buf.Len())
+	copy(b, buf.Bytes())
+	return b, nil
+}
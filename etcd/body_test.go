@@ -0,0 +1,74 @@
+package etcd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReadBodyConcurrent(t *testing.T) {
+	// Every key has its own value, of varying size
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/v2/keys")
+		w.Header().Set("X-Etcd-Index", "1")
+		fmt.Fprintf(w, `{"action":"get","node":{"key":"%s","value":"%s"}}`,
+			key, strings.Repeat(key, len(key)*10))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("/key%v", i)
+			for j := 0; j < 20; j++ {
+				resp, err := c.Get(key, false, false)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if resp.Node.Value != strings.Repeat(key, len(key)*10) {
+					errs <- fmt.Errorf("wrong value for %v: %.20s...", key, resp.Node.Value)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+var benchmarkBody = []byte(`{"action":"get","node":{"key":"/foo","value":"` +
+	strings.Repeat("bar", 2000) + `","modifiedIndex":7,"createdIndex":7}}`)
+
+func BenchmarkReadBody(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := readBody(bytes.NewReader(benchmarkBody)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadAll is the baseline for BenchmarkReadBody.
+func BenchmarkReadAll(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ioutil.ReadAll(bytes.NewReader(benchmarkBody)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package etcd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readCache keeps the responses of Get for a short while.
+type readCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	// generation counts the invalidations, so that a read which raced
+	// with a write is not cached, see start.
+	generation uint64
+}
+
+type cacheEntry struct {
+	// path is the path of the key, see keyToPath
+	path    string
+	raw     *RawResponse
+	expires time.Time
+}
+
+// EnableCache makes Get keep its responses in memory for the given
+// duration, and serve repeated reads of the same key from there. The
+// entries of a key are dropped whenever this client writes to the key,
+// one of its parents or its children, but changes made by anyone else
+// go unnoticed until the entries expire, so ttl should be short.
+// Only Get and GetLimited use the cache, and only under
+// WEAK_CONSISTENCY, see SetConsistency; the helpers built on reads,
+// such as Set with QuietSet, Export or Append, always read etcd.
+// A ttl of 0 disables the cache.
+func (c *Client) EnableCache(ttl time.Duration) {
+	if ttl <= 0 {
+		c.cache = nil
+		return
+	}
+
+	c.cache = &readCache{
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// cacheKey identifies a read in the cache.
+func cacheKey(key string, sort, recursive bool) string {
+	return fmt.Sprintf("%s?sorted=%v&recursive=%v", keyToPath(key), sort, recursive)
+}
+
+// get returns the cached response of the given read, if any. The fields
+// which describe the request that fetched it are cleared, as they do not
+// belong to this read.
+func (rc *readCache) get(key string, sort, recursive bool) *RawResponse {
+	if rc == nil {
+		return nil
+	}
+
+	rc.Lock()
+	defer rc.Unlock()
+
+	k := cacheKey(key, sort, recursive)
+	entry, ok := rc.entries[k]
+	if !ok {
+		return nil
+	}
+	if timeNow().After(entry.expires) {
+		delete(rc.entries, k)
+		return nil
+	}
+
+	raw := *entry.raw
+	raw.RequestID = ""
+	raw.Timeline = nil
+	raw.LeaderStats = nil
+	return &raw
+}
+
+// start returns the generation to give to put once the read sent after
+// it completes.
+func (rc *readCache) start() uint64 {
+	if rc == nil {
+		return 0
+	}
+
+	rc.Lock()
+	defer rc.Unlock()
+	return rc.generation
+}
+
+// put caches the response of the given read, unless the cache was
+// invalidated since the read started, as the response may predate the
+// write.
+func (rc *readCache) put(key string, sort, recursive bool, generation uint64, raw *RawResponse) {
+	if rc == nil {
+		return
+	}
+
+	rc.Lock()
+	defer rc.Unlock()
+
+	if generation != rc.generation {
+		return
+	}
+
+	rc.entries[cacheKey(key, sort, recursive)] = cacheEntry{
+		path:    keyToPath(key),
+		raw:     raw,
+		expires: timeNow().Add(rc.ttl),
+	}
+}
+
+// invalidate drops the cached reads of the given key, of its parents
+// and of its children.
+func (rc *readCache) invalidate(key string) {
+	if rc == nil {
+		return
+	}
+
+	rc.Lock()
+	defer rc.Unlock()
+
+	rc.generation++
+
+	p := strings.TrimSuffix(keyToPath(key), "/")
+	for k, entry := range rc.entries {
+		ep := strings.TrimSuffix(entry.path, "/")
+		if ep == p || strings.HasPrefix(ep, p+"/") || strings.HasPrefix(p, ep+"/") {
+			delete(rc.entries, k)
+		}
+	}
+}
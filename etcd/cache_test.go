@@ -0,0 +1,211 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnableCache(t *testing.T) {
+	gets := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			gets++
+			w.Write([]byte(`{"action":"get","node":{"key":"/fooDir/foo","value":"bar"}}`))
+			return
+		}
+		w.Write([]byte(`{"action":"set","node":{"key":"/fooDir/foo","value":"baz"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.SetConsistency(WEAK_CONSISTENCY)
+	c.EnableCache(time.Minute)
+
+	get := func(key string) {
+		resp, err := c.Get(key, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Node.Value != "bar" {
+			t.Fatalf("Get failed: %#v", resp.Node)
+		}
+	}
+
+	get("fooDir/foo")
+	get("/fooDir/foo")
+	if gets != 1 {
+		t.Fatalf("the second read should be served from the cache, got %v requests", gets)
+	}
+
+	// Writing the key, or its parent, drops it from the cache
+	if _, err := c.Set("fooDir/foo", "baz", 0); err != nil {
+		t.Fatal(err)
+	}
+	get("fooDir/foo")
+	if gets != 2 {
+		t.Fatalf("a write should invalidate the cache, got %v requests", gets)
+	}
+
+	if _, err := c.Delete("fooDir", true); err != nil {
+		t.Fatal(err)
+	}
+	get("fooDir/foo")
+	if gets != 3 {
+		t.Fatalf("a write to the parent should invalidate the cache, got %v requests", gets)
+	}
+
+	// Writing another key keeps it
+	if _, err := c.Set("fooDir/foo2", "baz", 0); err != nil {
+		t.Fatal(err)
+	}
+	get("fooDir/foo")
+	if gets != 3 {
+		t.Fatalf("a write to another key should keep the cache, got %v requests", gets)
+	}
+
+	c.EnableCache(10 * time.Millisecond)
+	get("fooDir/foo")
+	time.Sleep(20 * time.Millisecond)
+	get("fooDir/foo")
+	if gets != 5 {
+		t.Fatalf("expired entries should not be served, got %v requests", gets)
+	}
+
+	c.EnableCache(0)
+	get("fooDir/foo")
+	get("fooDir/foo")
+	if gets != 7 {
+		t.Fatalf("the disabled cache should not be used, got %v requests", gets)
+	}
+}
+
+func TestCacheRacingWrite(t *testing.T) {
+	started := make(chan bool)
+	written := make(chan bool)
+	var gets int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			w.Write([]byte(`{"action":"set","node":{"key":"/foo","value":"new"}}`))
+			return
+		}
+
+		// the first read is answered with the old value after the write
+		gets++
+		if gets == 1 {
+			started <- true
+			<-written
+			w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"old"}}`))
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"new"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.SetConsistency(WEAK_CONSISTENCY)
+	c.EnableCache(time.Minute)
+	c.RequestIDs = true
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Get("foo", false, false)
+		done <- err
+	}()
+	<-started
+	if _, err := c.Set("foo", "new", 0); err != nil {
+		t.Fatal(err)
+	}
+	close(written)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "new" {
+		t.Fatalf("the read which raced with the write was cached: %v", resp.Node.Value)
+	}
+
+	// a hit does not carry the request ID of the read which was cached
+	resp, err = c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gets != 2 {
+		t.Fatalf("the second read should be served from the cache, got %v requests", gets)
+	}
+	if resp.RequestID != "" {
+		t.Fatalf("a cached read kept the request ID %v", resp.RequestID)
+	}
+}
+
+func TestCacheQuietSetConcurrentWriter(t *testing.T) {
+	var lock sync.Mutex
+	value := "x"
+	var gets int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Method == "PUT" {
+			value = r.FormValue("value")
+		} else {
+			gets++
+		}
+		fmt.Fprintf(w, `{"action":"get","node":{"key":"/foo","value":"%v"}}`, value)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.SetConsistency(WEAK_CONSISTENCY)
+	c.EnableCache(time.Minute)
+	c.QuietSet = true
+
+	if _, err := c.Get("foo", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// another client changes the key behind the cache
+	lock.Lock()
+	value = "y"
+	lock.Unlock()
+
+	if _, err := c.Set("foo", "x", 0); err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if value != "x" {
+		t.Fatalf("Set compared against the cached value, the key is still %v", value)
+	}
+	if gets != 2 {
+		t.Fatalf("QuietSet should read etcd, got %v requests", gets)
+	}
+}
+
+func TestCacheStrongConsistency(t *testing.T) {
+	gets := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gets++
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.EnableCache(time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get("foo", false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if gets != 2 {
+		t.Fatalf("strongly consistent reads should not be cached, got %v requests", gets)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
@@ -12,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,6 +30,13 @@ const (
 	defaultBufferSize = 10
 )
 
+// ShuffleMachines makes NewClient and NewTLSClient shuffle the machines
+// they are given, so that the clients of a service spread over the
+// cluster when they fail over, rather than all trying the same machine
+// next. The first machine is still used as the leader until the actual
+// one is known.
+var ShuffleMachines = true
+
 type Config struct {
 	CertFile    string        `json:"certFile"`
 	KeyFile     string        `json:"keyFile"`
@@ -48,14 +57,185 @@ type Client struct {
 	// stops retrying if CheckRetry returns some error. The cases that
 	// this function needs to handle include no response and unexpected
 	// http status code of response.
-	// If CheckRetry is nil, client will call the default one
-	// `DefaultCheckRetry`.
+	// If CheckRetry is nil, client will call the default one, which
+	// works as `DefaultCheckRetry` with the client's MaxRetries.
 	// Argument cluster is the etcd.Cluster object that these requests have been made on.
 	// Argument numReqs is the number of http.Requests that have been made so far.
 	// Argument lastResp is the http.Responses from the last request.
 	// Argument err is the reason of the failure.
 	CheckRetry func(cluster *Cluster, numReqs int,
 		lastResp http.Response, err error) error
+	// QuietSet makes Set avoid waking up watchers when the key already
+	// holds the given value. If the TTL is unchanged nothing is written
+	// at all; if a TTL is given, the key is refreshed in place instead of
+	// being rewritten. This costs an additional GET for every Set.
+	QuietSet bool
+	// RetryBackoff is the delay before the first retry of a failed
+	// request. The delay doubles with every further retry, up to
+	// MaxRetryBackoff. If they are zero, 25ms is used, and a third of a
+	// second per machine, between half a second and 3 seconds.
+	// Long-term watches use the same backoff between reconnections.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// MaxRetries is how many times the default CheckRetry lets a failed
+	// request be retried; a negative value disables the retries. If zero,
+	// twice the number of machines is used, counting the first request,
+	// but at least 2 and at most 8 retries, so that a single machine is
+	// retried and a large cluster is not tried for too long.
+	MaxRetries int
+	// MaxMachinesTried limits the number of distinct machines a single
+	// request is sent to before giving up, regardless of how many
+	// retries CheckRetry would allow. Zero means no limit.
+	MaxMachinesTried int
+	// ProbeLeader makes the client look up the actual leader before
+	// sending its first request, instead of assuming the first machine
+	// is the leader until redirected. The result is kept until the
+	// cluster information is synced again.
+	ProbeLeader bool
+	// MinTTL is the shortest TTL accepted for keys and directories.
+	// Shorter TTLs are raised to MinTTL, or rejected with an error if
+	// RejectShortTTL is set. A TTL of 0, meaning no TTL, is left alone.
+	MinTTL         uint64
+	RejectShortTTL bool
+	// StrictKeys makes the client reject the keys with a . or .. segment
+	// or a control character with ErrInvalidKey. By default such keys are
+	// normalized like paths; a .. leading out of the root stays at the
+	// root, so "a/../../b" is the key /b.
+	StrictKeys bool
+	// MaxKeyLength is the length of the longest URL path, escaped, of
+	// the keys the client sends requests for, e.g. /v2/keys/foo for the
+	// key foo. Longer keys are rejected with ErrKeyTooLong rather than
+	// by a proxy with "414 URI Too Long". If zero, 4096 is used, which
+	// common proxies accept; a negative value disables the check.
+	MaxKeyLength int
+	// MaxValueBytes is the size of the largest value the client sends.
+	// Larger values are rejected with ErrValueTooLarge rather than by the
+	// server. If zero, etcd's default limit of 1MB is used; a negative
+	// value disables the check, e.g. for servers with a raised limit.
+	MaxValueBytes int
+	// RedirectStatusCodes are the status codes of the responses pointing
+	// to the leader. The request is sent again, with the same method, to
+	// the location they give. If nil, DefaultRedirectStatusCodes is used.
+	RedirectStatusCodes []int
+	// LeaderAffinityTTL, if positive, is how long the client sticks to
+	// the leader it adopted, after a redirect or a failover, without
+	// checking it. After that the leader is looked up with Ping before
+	// the next write, so that an idle client does not keep writing to a
+	// machine which lost the leadership meanwhile, only to be redirected.
+	LeaderAffinityTTL time.Duration
+	// RequireQuorum makes the client check, with HasQuorum, that the
+	// leader currently reaches a majority of the members before every
+	// write. If it does not, the write fails with ErrNoQuorum instead of
+	// going to a leader which may be about to lose the leadership. The
+	// check samples the leader statistics twice, which delays a write by
+	// a few hundred milliseconds; a quorum found is then trusted for a
+	// second.
+	RequireQuorum bool
+	// MemberURLSelector, if set, picks the URLs the client sends the
+	// requests for the given member to, e.g. because only its peer URLs
+	// are reachable from the client. SyncCluster then adopts the URLs it
+	// picks for every member listed under /v2/members, rather than the
+	// machines listed by etcd. If nil, the client URLs are used.
+	MemberURLSelector func(m Member) []string
+	// RetryableStatusCodes are the status codes, besides those etcd
+	// answers with and the redirects, of the responses which are retried
+	// as allowed by CheckRetry. Any other status code fails the request
+	// right away. If nil, DefaultRetryableStatusCodes is used.
+	RetryableStatusCodes []int
+	// ReadFallbackWeak makes reads fall back to the other machines, as
+	// under WEAK_CONSISTENCY, when the leader cannot be reached, instead
+	// of failing. Such reads may be stale, and are marked with
+	// ServedByFollower. Writes never fall back.
+	ReadFallbackWeak bool
+	// MaxLeaderChanges is how many different leaders a request follows
+	// redirects to in a row. Beyond that the leader is assumed to be
+	// changing faster than the request can catch up, so the client
+	// waits MaxRetryBackoff and sends the request again from scratch.
+	// If zero, 3 is used.
+	MaxLeaderChanges int
+	// FormCharset, if set, is sent as the charset of the form-encoded
+	// request bodies, e.g. "utf-8" for gateways which insist on it. By
+	// default the bare application/x-www-form-urlencoded type is sent.
+	FormCharset string
+	// MaxConcurrentRequests, if positive, is the number of requests the
+	// client sends at once. Further requests block until one of them is
+	// done, or until they are cancelled. Watches are not counted, since
+	// they may wait for changes indefinitely.
+	MaxConcurrentRequests int
+	// RequestIDs makes the client send a random X-Request-Id header with
+	// every request, the same for all of its retries, so that the logs
+	// of the client and of etcd can be matched. The ID is also set on
+	// the returned responses.
+	RequestIDs bool
+	// DiscoveryTimeout, if positive, bounds how long SyncCluster,
+	// SetCluster, Ping and ClusterHealth run in total, however many
+	// machines they try. When it runs out they give up: the cluster is
+	// not synced, Ping fails, and ClusterHealth counts the members which
+	// did not answer yet as unhealthy.
+	DiscoveryTimeout time.Duration
+	// Resolver, if set, resolves the host names of the machines instead
+	// of the default resolver, e.g. for a split-horizon DNS.
+	Resolver *net.Resolver
+	// RecordTimeline makes the client record every attempt to send a
+	// request, including the retries and the redirects followed, in the
+	// Timeline of the response, to find out where the time went.
+	RecordTimeline bool
+	// AttachLeaderStats makes the client fetch the uptime and the number
+	// of followers of the leader after every successful write, and set
+	// them as the LeaderStats of the response, so that writers keep an
+	// eye on the cluster as they go. This costs two more requests per
+	// write. If the statistics cannot be fetched, the write succeeds
+	// without them.
+	AttachLeaderStats bool
+	// Decoder, if set, decodes the bodies of the successful responses
+	// in place of json.Unmarshal, e.g. to use a faster JSON library. The
+	// indexes from the headers are set on the response afterwards.
+	// Responses carrying errors are still decoded as an EtcdError.
+	Decoder func(body []byte, resp *Response) error
+	// FieldAliases maps the JSON field names some etcd forks use for
+	// responses and nodes to the canonical ones, e.g. "prev_node" to
+	// "prevNode". Field names differing only in case, such as "Node",
+	// are matched without an alias. The aliases are applied before the
+	// Decoder, and must not be changed while the client is in use.
+	FieldAliases map[string]string
+	// UnknownResponseHandler, if set, is given the responses which are
+	// not from etcd: those with a status code etcd does not send, e.g.
+	// the error page of a proxy, and those whose body is neither a
+	// response nor an error. The error it returns fails the request,
+	// without retrying, so that callers can tell such failures apart.
+	// If it returns nil, the response is handled as by default.
+	UnknownResponseHandler func(status int, body []byte) error
+	// Tracer, if set, receives a span for every attempt to send a request.
+	Tracer Tracer
+	// StaleReadHook, if set, is called for every read answered by a
+	// machine whose raft index is behind the highest one the client has
+	// seen, which happens when reading from a lagging follower under
+	// WEAK_CONSISTENCY. It is meant for diagnostics; such a read may
+	// miss recent changes.
+	StaleReadHook func(machine string, raftIndex, knownIndex uint64)
+	// TrimValues makes Get, GetWithOptions and GetFresh strip leading and
+	// trailing whitespace, such as the newline some tools append, from
+	// every value they return. Only the returned values are trimmed, not
+	// the stored ones, so a trimmed value does not match the stored one
+	// in a CompareAndSwap or CompareAndDelete. Raw responses, and the
+	// helpers built on reads, such as Set with QuietSet, Append, Export
+	// or ConsistentSnapshot, see the values as stored.
+	TrimValues bool
+	// requestOptions are applied to every request, see WithRequestOptions.
+	requestOptions *RequestOptions
+	leaderProbed   bool
+	polls          *pollState
+	limiter        *requestLimiter
+	// interceptors wrap every attempt to send a request, see Use.
+	interceptors []Interceptor
+	// cache is nil unless enabled, see EnableCache.
+	cache *readCache
+	// clusterVersion is the *cachedVersion of ClusterVersion.
+	clusterVersion atomic.Value
+	// quorum is the *cachedQuorum of checkQuorum.
+	quorum atomic.Value
+	// leaderIndex is the *raftIndexSample of GetWithMaxStaleness.
+	leaderIndex atomic.Value
 }
 
 // NewClient create a basic client that is configured to be used
@@ -71,6 +251,11 @@ func NewClient(machines []string) *Client {
 	client := &Client{
 		cluster: NewCluster(machines),
 		config:  config,
+		polls:   newPollState(),
+		limiter: newRequestLimiter(),
+	}
+	if ShuffleMachines {
+		client.cluster.shuffle()
 	}
 
 	client.initHTTPClient()
@@ -99,6 +284,11 @@ func NewTLSClient(machines []string, cert, key, caCert string) (*Client, error)
 	client := &Client{
 		cluster: NewCluster(machines),
 		config:  config,
+		polls:   newPollState(),
+		limiter: newRequestLimiter(),
+	}
+	if ShuffleMachines {
+		client.cluster.shuffle()
 	}
 
 	err := client.initHTTPSClient(cert, key)
@@ -133,7 +323,10 @@ func NewClientFromFile(fpath string) (*Client, error) {
 // NewClientFromReader creates a Client configured from a given reader.
 // The configuration is expected to use the JSON format.
 func NewClientFromReader(reader io.Reader) (*Client, error) {
-	c := new(Client)
+	c := &Client{
+		polls:   newPollState(),
+		limiter: newRequestLimiter(),
+	}
 
 	b, err := ioutil.ReadAll(reader)
 	if err != nil {
@@ -176,7 +369,7 @@ func (c *Client) initHTTPClient() {
 			InsecureSkipVerify: true,
 		},
 	}
-	c.httpClient = &http.Client{Transport: tr}
+	c.httpClient = &http.Client{Transport: tr, CheckRedirect: doNotFollowRedirects}
 }
 
 // initHTTPClient initializes a HTTPS client for etcd client
@@ -200,10 +393,30 @@ func (c *Client) initHTTPSClient(cert, key string) error {
 		Dial:            c.dial,
 	}
 
-	c.httpClient = &http.Client{Transport: tr}
+	c.httpClient = &http.Client{Transport: tr, CheckRedirect: doNotFollowRedirects}
 	return nil
 }
 
+// doNotFollowRedirects stops the HTTP client from following redirects,
+// so that SendRequest sees them and remembers the leader they point to
+// instead of being redirected again on every request.
+func doNotFollowRedirects(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// WithRequestOptions returns a client which applies the given options to
+// all of its requests, which is meant for one-off calls such as
+//
+//	c.WithRequestOptions(RequestOptions{Header: h}).Get("foo", false, false)
+//
+// The returned client shares the cluster information and the transport
+// with c, but changes to its settings do not affect c.
+func (c *Client) WithRequestOptions(opts RequestOptions) *Client {
+	clone := *c
+	clone.requestOptions = &opts
+	return &clone
+}
+
 // SetPersistence sets a writer to which the config will be
 // written every time it's changed.
 func (c *Client) SetPersistence(writer io.Writer) {
@@ -231,6 +444,47 @@ func (c *Client) SetConsistency(consistency string) error {
 	return nil
 }
 
+// SetResponseHeaderTimeout bounds how long the client waits for a machine
+// to start answering a request it sent, apart from the time it takes to
+// connect. A machine which accepted the connection but hangs, like a
+// stuck leader, then counts as unreachable, and the request fails over
+// to another machine. Zero, the default, waits indefinitely. Watches are
+// not hurt, since etcd sends their headers right away. The timeout is
+// set on the transport, and has to be set again after SetTransport.
+func (c *Client) SetResponseHeaderTimeout(timeout time.Duration) error {
+	tr, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("The transport of the client is not an *http.Transport")
+	}
+
+	tr.ResponseHeaderTimeout = timeout
+	return nil
+}
+
+// SetExpectContinueTimeout makes writes send their body only once the
+// machine accepted the request, by answering "Expect: 100-continue", so
+// that a large value is not sent in vain to a machine, or a proxy, which
+// redirects or rejects the request. The body is sent anyway if there is
+// no answer within the given timeout. Zero, the default, disables the
+// handshake. The timeout is set on the transport, and has to be set
+// again after SetTransport.
+func (c *Client) SetExpectContinueTimeout(timeout time.Duration) error {
+	tr, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("The transport of the client is not an *http.Transport")
+	}
+
+	tr.ExpectContinueTimeout = timeout
+	return nil
+}
+
+// expectContinue reports whether writes wait for "100 Continue" before
+// sending their body, see SetExpectContinueTimeout.
+func (c *Client) expectContinue() bool {
+	tr, ok := c.httpClient.Transport.(*http.Transport)
+	return ok && tr.ExpectContinueTimeout > 0
+}
+
 // AddRootCA adds a root CA cert for the etcd client
 func (c *Client) AddRootCA(caCert string) error {
 	if c.httpClient == nil {
@@ -275,6 +529,16 @@ func (c *Client) SetCluster(machines []string) bool {
 	return success
 }
 
+// SetMachineWeights sets the relative weights used when picking a random
+// machine for reads under WEAK_CONSISTENCY. A machine with weight 2 is
+// picked twice as often as a machine with weight 1. Machines missing
+// from the map default to a weight of 1, and machines with a weight of 0
+// are only used if every machine has a weight of 0.
+// Passing nil restores the uniform selection.
+func (c *Client) SetMachineWeights(weights map[string]int) {
+	c.cluster.weights = weights
+}
+
 func (c *Client) GetCluster() []string {
 	return c.cluster.Machines
 }
@@ -284,11 +548,180 @@ func (c *Client) SyncCluster() bool {
 	return c.internalSyncCluster(c.cluster.Machines)
 }
 
+// Ping checks that the cluster can be reached and returns the client URL
+// of its current leader, as seen by the machine answering the request.
+// An error is returned if no machine can be reached or if the cluster
+// has no leader.
+//
+// Ping is bounded by DiscoveryTimeout.
+func (c *Client) Ping() (string, error) {
+	d := c.startDiscovery()
+	defer d.stop()
+
+	stats, err := c.getSelfStats(d.cancel)
+	if err != nil {
+		return "", d.err(err)
+	}
+
+	leader := stats.LeaderInfo.Leader
+	if leader == "" {
+		return "", errors.New("The cluster has no leader")
+	}
+
+	members, err := c.getMembers(d.cancel)
+	if err != nil {
+		return "", d.err(err)
+	}
+
+	for _, member := range members {
+		if urls := c.memberURLs(member); member.ID == leader && len(urls) > 0 {
+			return urls[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown leader %v", leader)
+}
+
+// WaitForLeader calls Ping until the cluster has a leader, and returns
+// its client URL, or gives up after the given timeout. It lets a program
+// wait for etcd to be able to serve writes on startup. The polls are
+// spaced out like retries, see RetryBackoff.
+func (c *Client) WaitForLeader(timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	backoff := c.newBackoff()
+
+	for {
+		leader, err := c.Ping()
+		if err == nil {
+			return leader, nil
+		}
+
+		logger.Debug("wait.for.leader ", err)
+		sleep := backoff.next()
+		if time.Now().Add(sleep).After(deadline) {
+			return "", fmt.Errorf("No leader within %v: %v", timeout, err)
+		}
+		time.Sleep(sleep)
+	}
+}
+
+// WithLeader looks up the leader with Ping and runs fn, whose requests
+// then go to the leader directly, rather than each being redirected to
+// it. If fn fails and the leadership changed meanwhile, the new leader
+// is looked up and fn is run again from the start, up to
+// MaxLeaderChanges times; fn must thus be safe to run again. The error
+// of its last run is returned.
+func (c *Client) WithLeader(fn func(c *Client) error) error {
+	for changes := 0; ; changes++ {
+		leader, err := c.Ping()
+		if err != nil {
+			return err
+		}
+		c.cluster.updateLeader(leader)
+
+		err = fn(c)
+		if err == nil || c.cluster.Leader == leader || changes >= c.maxLeaderChanges() {
+			return err
+		}
+		logger.Debugf("with.leader %v lost the leadership to %v, running again: %v",
+			leader, c.cluster.Leader, err)
+	}
+}
+
+// probeLeader looks up the actual leader if ProbeLeader is set
+// and it was not done yet.
+func (c *Client) probeLeader() {
+	if !c.ProbeLeader || c.leaderProbed {
+		return
+	}
+
+	// Ping sends requests itself
+	c.leaderProbed = true
+
+	leader, err := c.Ping()
+	if err != nil {
+		logger.Warning("probe.leader failed: ", err)
+		c.leaderProbed = false
+		return
+	}
+
+	c.cluster.updateLeader(leader)
+}
+
+// cachedQuorum is a quorum found by checkQuorum.
+type cachedQuorum struct {
+	leader  string
+	expires time.Time
+}
+
+// checkQuorum fails a write with ErrNoQuorum if RequireQuorum is set
+// and the leader does not reach a majority of the machines. A quorum is
+// trusted for quorumCacheTTL, as long as the leader stays the same, so
+// that a burst of writes is checked once.
+func (c *Client) checkQuorum(rr *RawRequest) error {
+	if !c.RequireQuorum || rr.Method == "GET" || rr.Method == "HEAD" {
+		return nil
+	}
+
+	if cached, _ := c.quorum.Load().(*cachedQuorum); cached != nil &&
+		cached.leader == c.cluster.Leader && timeNow().Before(cached.expires) {
+		return nil
+	}
+
+	hasQuorum, err := c.hasQuorum(rr.Cancel)
+	if err != nil {
+		return err
+	}
+	if !hasQuorum {
+		return ErrNoQuorum
+	}
+
+	c.quorum.Store(&cachedQuorum{
+		leader:  c.cluster.Leader,
+		expires: timeNow().Add(quorumCacheTTL),
+	})
+	return nil
+}
+
+// verifyLeader looks up the actual leader, for a write, if the current
+// one was adopted longer than LeaderAffinityTTL ago. If the lookup fails,
+// the current leader is kept until LeaderAffinityTTL passes again.
+func (c *Client) verifyLeader(rr *RawRequest) {
+	if c.LeaderAffinityTTL <= 0 || rr.Method == "GET" || rr.Method == "HEAD" ||
+		timeNow().Sub(c.cluster.leaderSince) < c.LeaderAffinityTTL {
+		return
+	}
+
+	leader, err := c.Ping()
+	if err != nil {
+		logger.Warning("verify.leader failed: ", err)
+		c.cluster.leaderSince = timeNow()
+		return
+	}
+
+	c.cluster.updateLeader(leader)
+}
+
 // internalSyncCluster syncs cluster information using the given machine list.
+// It gives up when DiscoveryTimeout runs out.
 func (c *Client) internalSyncCluster(machines []string) bool {
+	d := c.startDiscovery()
+	defer d.stop()
+
 	for _, machine := range machines {
-		httpPath := c.createHttpPath(machine, path.Join(version, "machines"))
-		resp, err := c.httpClient.Get(httpPath)
+		if d.expired() {
+			logger.Warning("sync.machines timed out after ", d.timeout)
+			return false
+		}
+
+		// each request gets whatever time is left
+		client := d.httpClient(c.httpClient)
+		endpoint := "machines"
+		if c.MemberURLSelector != nil {
+			endpoint = "members"
+		}
+		httpPath := c.createHttpPath(machine, path.Join(version, endpoint))
+		resp, err := c.getURL(client, machine, httpPath)
 		if err != nil {
 			// try another machine in the cluster
 			continue
@@ -301,11 +734,17 @@ func (c *Client) internalSyncCluster(machines []string) bool {
 			}
 
 			// update Machines List
-			c.cluster.updateFromStr(string(b))
+			if c.MemberURLSelector == nil {
+				c.cluster.updateFromStr(string(b))
+			} else if err := c.updateFromMembers(b); err != nil {
+				logger.Debugf("sync.members %s failed: %v", machine, err)
+				continue
+			}
 
 			// update leader
 			// the first one in the machine list is the leader
 			c.cluster.switchLeader(0)
+			c.leaderProbed = false
 
 			logger.Debug("sync.machines ", c.cluster.Machines)
 			c.saveConfig()
@@ -332,9 +771,11 @@ func (c *Client) createHttpPath(serverName string, _path string) string {
 }
 
 // dial attempts to open a TCP connection to the provided address, explicitly
-// enabling keep-alives with a one-second interval.
+// enabling keep-alives with a one-second interval. Host names are resolved
+// with the Resolver, if any.
 func (c *Client) dial(network, addr string) (net.Conn, error) {
-	conn, err := net.DialTimeout(network, addr, c.config.DialTimeout)
+	dialer := net.Dialer{Timeout: c.config.DialTimeout, Resolver: c.Resolver}
+	conn, err := dialer.Dial(network, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -1,12 +1,21 @@
 package etcd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 // To pass this test, we need to create a cluster of 3 machines
@@ -94,3 +103,575 @@ func TestPersistence(t *testing.T) {
 		t.Fatalf("The two configs should be equal!")
 	}
 }
+
+func TestSetMachineWeights(t *testing.T) {
+	machines := []string{"http://a:4001", "http://b:4001", "http://c:4001"}
+	c := NewClient(machines)
+	c.SetMachineWeights(map[string]int{
+		"http://a:4001": 1,
+		"http://b:4001": 3,
+		"http://c:4001": 0,
+	})
+
+	counts := make(map[string]int)
+	total := 10000
+	for i := 0; i < total; i++ {
+		counts[c.cluster.pickMachine()]++
+	}
+
+	if counts["http://c:4001"] != 0 {
+		t.Fatalf("machine with weight 0 was picked %v times", counts["http://c:4001"])
+	}
+
+	// b should get roughly three quarters of the requests
+	ratio := float64(counts["http://b:4001"]) / float64(total)
+	if ratio < 0.7 || ratio > 0.8 {
+		t.Fatalf("machine b got %v of the requests, expected about 0.75", ratio)
+	}
+}
+
+func TestPing(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/stats/self":
+			w.Write([]byte(`{"name":"a","id":"1","state":"StateFollower","leaderInfo":{"leader":"2"}}`))
+		case "/v2/members":
+			w.Write([]byte(`{"members":[
+				{"id":"1","name":"a","clientURLs":["http://a:4001"]},
+				{"id":"2","name":"b","clientURLs":["http://b:4001"]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	leader, err := c.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader != "http://b:4001" {
+		t.Fatalf("Ping returned %v as the leader, expected http://b:4001", leader)
+	}
+
+	// Nothing is listening on the closed server anymore
+	ts.Close()
+	c = NewClient([]string{ts.URL})
+	if _, err = c.Ping(); err == nil {
+		t.Fatal("Ping should fail when no machine is reachable")
+	}
+}
+
+func TestWaitForLeader(t *testing.T) {
+	polls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/stats/self":
+			// the election only ends after a few polls
+			polls++
+			if polls < 3 {
+				w.Write([]byte(`{"name":"a","id":"1","state":"StateFollower","leaderInfo":{"leader":""}}`))
+				return
+			}
+			w.Write([]byte(`{"name":"a","id":"1","state":"StateFollower","leaderInfo":{"leader":"2"}}`))
+		case "/v2/members":
+			w.Write([]byte(`{"members":[
+				{"id":"1","name":"a","clientURLs":["http://a:4001"]},
+				{"id":"2","name":"b","clientURLs":["http://b:4001"]}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.RetryBackoff = time.Millisecond
+
+	leader, err := c.WaitForLeader(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(leader == "http://b:4001" && polls == 3) {
+		t.Fatalf("WaitForLeader returned %v after %v polls", leader, polls)
+	}
+
+	polls = 0
+	if _, err := c.WaitForLeader(0); err == nil {
+		t.Fatal("WaitForLeader should time out while there is no leader")
+	}
+}
+
+// newSlowServers returns n machines which take delay to answer any
+// request.
+func newSlowServers(n int, delay time.Duration) []*httptest.Server {
+	servers := make([]*httptest.Server, n)
+	for i := range servers {
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			http.NotFound(w, r)
+		}))
+	}
+	return servers
+}
+
+func TestDiscoveryTimeout(t *testing.T) {
+	servers := newSlowServers(3, 500*time.Millisecond)
+	var machines []string
+	for _, ts := range servers {
+		defer ts.Close()
+		machines = append(machines, ts.URL)
+	}
+
+	c := NewClient(machines)
+	c.DiscoveryTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	if c.SyncCluster() {
+		t.Fatal("SyncCluster should fail at the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("SyncCluster took %v, expected about %v", elapsed, c.DiscoveryTimeout)
+	}
+
+	start = time.Now()
+	if _, err := c.Ping(); err == nil {
+		t.Fatal("Ping should fail at the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("Ping took %v, expected about %v", elapsed, c.DiscoveryTimeout)
+	}
+}
+
+// newLeaderServers returns a leader and a follower which redirects
+// requests for keys to the leader. Both count the requests for keys
+// they receive.
+func newLeaderServers(leaderHits, followerHits *int) (*httptest.Server, *httptest.Server) {
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*leaderHits++
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"action":"set","node":{"key":"/foo","value":"bar"}}`))
+	}))
+
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/stats/self":
+			w.Write([]byte(`{"id":"1","leaderInfo":{"leader":"2"}}`))
+		case "/v2/members":
+			fmt.Fprintf(w, `{"members":[
+				{"id":"1","clientURLs":["http://%v"]},
+				{"id":"2","clientURLs":["%v"]}]}`, r.Host, leader.URL)
+		default:
+			*followerHits++
+			http.Redirect(w, r, leader.URL+r.URL.Path, http.StatusTemporaryRedirect)
+		}
+	}))
+
+	return leader, follower
+}
+
+func TestLeaderRedirect(t *testing.T) {
+	var leaderHits, followerHits int
+	leader, follower := newLeaderServers(&leaderHits, &followerHits)
+	defer leader.Close()
+	defer follower.Close()
+
+	c := NewClient([]string{follower.URL, leader.URL})
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Set("foo", "bar", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first request should have been redirected
+	if c.cluster.Leader != leader.URL {
+		t.Fatalf("the leader should be %v, not %v", leader.URL, c.cluster.Leader)
+	}
+	if !(followerHits == 1 && leaderHits == 3) {
+		t.Fatalf("unexpected hits: follower %v, leader %v", followerHits, leaderHits)
+	}
+}
+
+func TestProbeLeader(t *testing.T) {
+	var leaderHits, followerHits int
+	leader, follower := newLeaderServers(&leaderHits, &followerHits)
+	defer leader.Close()
+	defer follower.Close()
+
+	c := NewClient([]string{follower.URL, leader.URL})
+	c.ProbeLeader = true
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.Set("foo", "bar", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No request should have been redirected
+	if c.cluster.Leader != leader.URL {
+		t.Fatalf("the leader should be %v, not %v", leader.URL, c.cluster.Leader)
+	}
+	if !(followerHits == 0 && leaderHits == 3) {
+		t.Fatalf("unexpected hits: follower %v, leader %v", followerHits, leaderHits)
+	}
+}
+
+// newElectionServers returns two machines, whose leader is the one given
+// by leader. The other one redirects the writes to it; both count the
+// writes they receive.
+func newElectionServers(leader *int, redirects *int) (a, b *httptest.Server) {
+	var servers [2]*httptest.Server
+	for i := range servers {
+		id := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v2/stats/self":
+				fmt.Fprintf(w, `{"id":"%v","leaderInfo":{"leader":"%v"}}`, id, *leader)
+			case "/v2/members":
+				fmt.Fprintf(w, `{"members":[
+					{"id":"0","clientURLs":["%v"]},
+					{"id":"1","clientURLs":["%v"]}]}`, servers[0].URL, servers[1].URL)
+			default:
+				if id != *leader {
+					*redirects++
+					http.Redirect(w, r, servers[*leader].URL+r.URL.Path, http.StatusTemporaryRedirect)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte(`{"action":"set","node":{"key":"/foo","value":"bar"}}`))
+			}
+		}))
+	}
+	return servers[0], servers[1]
+}
+
+func TestLeaderAffinityTTL(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	var leader, redirects int
+	a, b := newElectionServers(&leader, &redirects)
+	defer a.Close()
+	defer b.Close()
+
+	c := NewClient([]string{a.URL, b.URL})
+	c.LeaderAffinityTTL = time.Minute
+
+	// b is elected, the first machine is not trusted to be the leader
+	leader = 1
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !(c.cluster.Leader == b.URL && redirects == 0) {
+		t.Fatalf("the leader should have been verified, %v redirects", redirects)
+	}
+
+	// Within the affinity, the leader is trusted
+	leader = 0
+	now = now.Add(30 * time.Second)
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !(c.cluster.Leader == a.URL && redirects == 1) {
+		t.Fatalf("the write should have been redirected to %v", a.URL)
+	}
+
+	// Once it expired, the leader is verified before writing
+	leader = 1
+	now = now.Add(2 * time.Minute)
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !(c.cluster.Leader == b.URL && redirects == 1) {
+		t.Fatalf("the leader should have been verified, %v redirects", redirects)
+	}
+}
+
+// newStubResolver returns a resolver which answers every query for an
+// IPv4 address with 127.0.0.1, and has no IPv6 addresses.
+func newStubResolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveStubDNS(server)
+			return client, nil
+		},
+	}
+}
+
+// serveStubDNS answers a single DNS query, framed as over TCP.
+func serveStubDNS(conn net.Conn) {
+	defer conn.Close()
+
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return
+	}
+	query := make([]byte, int(size[0])<<8|int(size[1]))
+	if _, err := io.ReadFull(conn, query); err != nil {
+		return
+	}
+
+	// The question follows the 12 byte header: the labels of the name,
+	// then its type and class
+	end := 12
+	for query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	end += 5
+	isA := query[end-4] == 0 && query[end-3] == 1
+
+	resp := []byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}
+	resp = append(resp, query[12:end]...)
+	if isA {
+		resp[7] = 1
+		// the name points to the question, TTL of 60s
+		resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 127, 0, 0, 1)
+	}
+
+	conn.Write(append([]byte{byte(len(resp) >> 8), byte(len(resp))}, resp...))
+}
+
+func TestResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Etcd-Index", "1")
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	c := NewClient([]string{"http://etcd.invalid:" + port})
+	c.Resolver = newStubResolver()
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "bar" {
+		t.Fatalf("Get through the resolver failed: %v", resp.Node.Value)
+	}
+}
+
+func TestWithLeader(t *testing.T) {
+	var leader, redirects int
+	a, b := newElectionServers(&leader, &redirects)
+	defer a.Close()
+	defer b.Close()
+
+	c := NewClient([]string{a.URL, b.URL})
+
+	var machines []string
+	c.Use(func(req *http.Request, next func() (*http.Response, error)) (*http.Response, error) {
+		if req.Method == "PUT" {
+			machines = append(machines, "http://"+req.URL.Host)
+		}
+		return next()
+	})
+
+	// b is the leader, unlike the client believes
+	leader = 1
+	runs := 0
+	err := c.WithLeader(func(c *Client) error {
+		runs++
+		for i := 0; i < 3; i++ {
+			if _, err := c.Set("foo", "bar", 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(runs == 1 && redirects == 0) {
+		t.Fatalf("WithLeader ran %v times with %v redirects, expected once without", runs, redirects)
+	}
+	if !reflect.DeepEqual(machines, []string{b.URL, b.URL, b.URL}) {
+		t.Fatalf("the writes went to %q, expected all of them to go to %v", machines, b.URL)
+	}
+
+	// a is elected in the middle of the first run, which fails
+	runs = 0
+	err = c.WithLeader(func(c *Client) error {
+		runs++
+		if _, err := c.Set("foo", "bar", 0); err != nil {
+			return err
+		}
+		if runs == 1 {
+			leader = 0
+			c.Set("foo", "bar", 0)
+			return errors.New("interrupted")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 {
+		t.Fatalf("WithLeader ran %v times, expected again after the election", runs)
+	}
+
+	// failures without an election are returned as is
+	runs = 0
+	err = c.WithLeader(func(c *Client) error {
+		runs++
+		return errors.New("failed")
+	})
+	if !(err != nil && err.Error() == "failed" && runs == 1) {
+		t.Fatalf("WithLeader ran %v times and returned %v", runs, err)
+	}
+}
+
+func TestSetResponseHeaderTimeout(t *testing.T) {
+	// The leader accepts the request, but never answers
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{hung.URL, ts.URL})
+	c.RetryBackoff = time.Millisecond
+	if err := c.SetResponseHeaderTimeout(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "bar" {
+		t.Fatalf("Get failed: %#v", resp.Node)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Get failed over after %v, expected about 100ms", elapsed)
+	}
+
+	c.httpClient.Transport = roundTripperFunc(http.DefaultTransport.RoundTrip)
+	if err := c.SetResponseHeaderTimeout(time.Second); err == nil {
+		t.Fatal("SetResponseHeaderTimeout should fail on a custom transport")
+	}
+}
+
+func TestShuffleMachines(t *testing.T) {
+	defer func() {
+		ShuffleMachines = true
+	}()
+
+	var machines []string
+	for i := 0; i < 10; i++ {
+		machines = append(machines, fmt.Sprintf("http://%c:4001", 'a'+i))
+	}
+
+	orders := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		c := NewClient(machines)
+		if c.cluster.Leader != machines[0] {
+			t.Fatalf("the leader should be the first machine, not %v", c.cluster.Leader)
+		}
+
+		shuffled := append([]string(nil), c.GetCluster()...)
+		orders[strings.Join(shuffled, ",")] = true
+		sort.Strings(shuffled)
+		if !reflect.DeepEqual(shuffled, machines) {
+			t.Fatalf("the shuffled machines %q differ from %q", shuffled, machines)
+		}
+	}
+	if len(orders) == 1 {
+		t.Fatal("the machines were not shuffled")
+	}
+	if machines[0] != "http://a:4001" {
+		t.Fatalf("the given machines were shuffled in place: %q", machines)
+	}
+
+	ShuffleMachines = false
+	for i := 0; i < 10; i++ {
+		c := NewClient(machines)
+		if !reflect.DeepEqual(c.GetCluster(), machines) {
+			t.Fatalf("the machines were shuffled to %q", c.GetCluster())
+		}
+	}
+}
+
+func TestMemberURLSelector(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/machines":
+			fmt.Fprint(w, "http://a:2379, http://b:2379")
+		case "/v2/members":
+			fmt.Fprint(w, `{"members":[
+				{"id":"a","name":"a","peerURLs":["http://a:2380"],"clientURLs":["http://a:2379"]},
+				{"id":"b","name":"b","peerURLs":["http://b:2380"],"clientURLs":["http://b:2379"]}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	if !c.SyncCluster() {
+		t.Fatal("SyncCluster failed")
+	}
+	expected := []string{"http://a:2379", "http://b:2379"}
+	if !reflect.DeepEqual(c.GetCluster(), expected) {
+		t.Fatalf("SyncCluster adopted %q, expected the client URLs %q", c.GetCluster(), expected)
+	}
+
+	c = NewClient([]string{ts.URL})
+	c.MemberURLSelector = func(m Member) []string {
+		return m.PeerURLs
+	}
+	if !c.SyncCluster() {
+		t.Fatal("SyncCluster failed")
+	}
+	expected = []string{"http://a:2380", "http://b:2380"}
+	if !reflect.DeepEqual(c.GetCluster(), expected) {
+		t.Fatalf("SyncCluster adopted %q, expected the selected URLs %q", c.GetCluster(), expected)
+	}
+}
+
+func TestSetExpectContinueTimeout(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	var expects []string
+	c.Use(func(req *http.Request, next func() (*http.Response, error)) (*http.Response, error) {
+		expects = append(expects, req.Method+" "+req.Header.Get("Expect"))
+		return next()
+	})
+
+	if err := c.SetExpectContinueTimeout(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if tr := c.httpClient.Transport.(*http.Transport); tr.ExpectContinueTimeout != time.Second {
+		t.Fatalf("the transport waits %v for 100 Continue, expected 1s", tr.ExpectContinueTimeout)
+	}
+
+	if _, err := c.Set("foo", "bar", 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("foo", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"PUT 100-continue", "GET "}
+	if !reflect.DeepEqual(expects, expected) {
+		t.Fatalf("the requests were sent as %q, expected %q", expects, expected)
+	}
+
+	c.httpClient.Transport = roundTripperFunc(http.DefaultTransport.RoundTrip)
+	if err := c.SetExpectContinueTimeout(time.Second); err == nil {
+		t.Fatal("SetExpectContinueTimeout should fail on a custom transport")
+	}
+}
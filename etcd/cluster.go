@@ -1,13 +1,33 @@
 package etcd
 
 import (
+	"math/rand"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// timeNow is the clock of the expiries the tests replace: the leader
+// affinity, and the cached reads, cluster version, quorum and leader
+// raft index. The deadlines which are waited for, and the timings of the
+// attempts, are on time.Now.
+var timeNow = time.Now
+
 type Cluster struct {
+	// raftIndex is the highest raft index seen in a response. It comes
+	// first to keep it aligned for atomic access.
+	raftIndex uint64
+
 	Leader   string   `json:"leader"`
 	Machines []string `json:"machines"`
+	// leaderSince is when the leader was last adopted, after a redirect
+	// or a failover, or verified; zero if it is only the first machine.
+	// See Client.LeaderAffinityTTL.
+	leaderSince time.Time
+	// weights biases the random selection of machines, see
+	// Client.SetMachineWeights.
+	weights map[string]int
 }
 
 func NewCluster(machines []string) *Cluster {
@@ -23,12 +43,96 @@ func NewCluster(machines []string) *Cluster {
 	}
 }
 
+// shuffle puts the machines in a random order, so that clients given
+// the same list do not all fail over to the same machines in turn. The
+// leader is kept.
+func (cl *Cluster) shuffle() {
+	machines := make([]string, len(cl.Machines))
+	for i, j := range rand.Perm(len(cl.Machines)) {
+		machines[i] = cl.Machines[j]
+	}
+	cl.Machines = machines
+}
+
+// observeRaftIndex records a raft index seen in a response and returns
+// the highest one seen so far.
+func (cl *Cluster) observeRaftIndex(index uint64) uint64 {
+	for {
+		known := atomic.LoadUint64(&cl.raftIndex)
+		if index <= known {
+			return known
+		}
+		if atomic.CompareAndSwapUint64(&cl.raftIndex, known, index) {
+			return index
+		}
+	}
+}
+
 // switchLeader switch the current leader to machines[num]
 func (cl *Cluster) switchLeader(num int) {
 	logger.Debugf("switch.leader[from %v to %v]",
 		cl.Leader, cl.Machines[num])
 
 	cl.Leader = cl.Machines[num]
+	cl.leaderSince = timeNow()
+}
+
+// pickMachine returns a random machine, favoring machines
+// proportionally to their weights.
+func (cl *Cluster) pickMachine() string {
+	if len(cl.weights) == 0 {
+		return cl.Machines[rand.Intn(len(cl.Machines))]
+	}
+
+	total := 0
+	for _, machine := range cl.Machines {
+		total += cl.weight(machine)
+	}
+
+	// all the machines were disabled, fall back to a uniform choice
+	if total == 0 {
+		return cl.Machines[rand.Intn(len(cl.Machines))]
+	}
+
+	n := rand.Intn(total)
+	for _, machine := range cl.Machines {
+		n -= cl.weight(machine)
+		if n < 0 {
+			return machine
+		}
+	}
+
+	return cl.Machines[len(cl.Machines)-1]
+}
+
+// pickOther returns a random machine other than the given one, unless
+// there is no other machine.
+func (cl *Cluster) pickOther(machine string) string {
+	for i := 0; i < len(cl.Machines); i++ {
+		if m := cl.pickMachine(); m != machine {
+			return m
+		}
+	}
+
+	for _, m := range cl.Machines {
+		if m != machine {
+			return m
+		}
+	}
+	return machine
+}
+
+// weight returns the weight of the given machine. Machines without
+// a configured weight default to 1.
+func (cl *Cluster) weight(machine string) int {
+	w, ok := cl.weights[machine]
+	if !ok {
+		return 1
+	}
+	if w < 0 {
+		return 0
+	}
+	return w
 }
 
 func (cl *Cluster) updateFromStr(machines string) {
@@ -38,6 +142,7 @@ func (cl *Cluster) updateFromStr(machines string) {
 func (cl *Cluster) updateLeader(leader string) {
 	logger.Debugf("update.leader[%s,%s]", cl.Leader, leader)
 	cl.Leader = leader
+	cl.leaderSince = timeNow()
 }
 
 func (cl *Cluster) updateLeaderFromURL(u *url.URL) {
@@ -47,5 +152,14 @@ func (cl *Cluster) updateLeaderFromURL(u *url.URL) {
 	} else {
 		leader = u.Scheme + "://" + u.Host
 	}
+
+	// keep the credentials of a known machine at the same host, since
+	// the redirect location won't carry them
+	for _, machine := range cl.Machines {
+		if m, err := url.Parse(machine); err == nil && m.User != nil && m.Host == u.Host {
+			leader = machine
+			break
+		}
+	}
 	cl.updateLeader(leader)
 }
@@ -1,7 +1,20 @@
 package etcd
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
+// Errors introduced by queues
+var (
+	ErrQueueEmpty = errors.New("The queue is empty")
+)
+
+// CompareAndDelete deletes the given key if its current value equals
+// prevValue and its ModifiedIndex equals prevIndex. An empty prevValue or a
+// zero prevIndex is not compared. If the comparison fails, an *EtcdError
+// with ErrCodeCompareFailed is returned, carrying the current etcd index,
+// and the comparison that failed in its Cause.
 func (c *Client) CompareAndDelete(key string, prevValue string, prevIndex uint64) (*Response, error) {
 	raw, err := c.RawCompareAndDelete(key, prevValue, prevIndex)
 	if err != nil {
@@ -32,3 +45,43 @@ func (c *Client) RawCompareAndDelete(key string, prevValue string, prevIndex uin
 
 	return raw, err
 }
+
+// Pop removes and returns the first key of the queue in the given
+// directory, that is its lowest ordered key, as added by CreateInOrder.
+// The key is compare-and-deleted by index, so that each key is popped by
+// one consumer only; if another consumer was faster, the next key is
+// tried. ErrQueueEmpty is returned if the directory has no key left or
+// does not exist.
+func (c *Client) Pop(dir string) (*Node, error) {
+	for {
+		resp, err := c.read(dir, true, false)
+		if err != nil {
+			if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyNotFound {
+				return nil, ErrQueueEmpty
+			}
+			return nil, err
+		}
+
+		var first *Node
+		for _, n := range resp.Node.Nodes {
+			if !n.Dir {
+				first = n
+				break
+			}
+		}
+		if first == nil {
+			return nil, ErrQueueEmpty
+		}
+
+		resp, err = c.CompareAndDelete(first.Key, "", first.ModifiedIndex)
+		if err == nil {
+			return resp.PrevNode, nil
+		}
+
+		etcdErr, ok := err.(*EtcdError)
+		if !ok || (etcdErr.ErrorCode != ErrCodeCompareFailed && etcdErr.ErrorCode != ErrCodeKeyNotFound) {
+			return nil, err
+		}
+		logger.Debug("pop.retry ", first.Key)
+	}
+}
@@ -1,6 +1,7 @@
 package etcd
 
 import (
+	"sync"
 	"testing"
 )
 
@@ -44,3 +45,82 @@ func TestCompareAndDelete(t *testing.T) {
 		t.Fatalf("CompareAndDelete 4 should have failed.  The response is: %#v", resp)
 	}
 }
+
+func TestCompareAndDeleteConflict(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	resp, err := c.Set("foo", "bar", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staleIndex := resp.Node.ModifiedIndex
+
+	resp, err = c.Set("foo", "bar2", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.CompareAndDelete("foo", "", staleIndex)
+	etcdErr, ok := err.(*EtcdError)
+	if !ok {
+		t.Fatalf("CompareAndDelete should return an *EtcdError: %#v", err)
+	}
+	if etcdErr.ErrorCode != ErrCodeCompareFailed {
+		t.Fatalf("CompareAndDelete returned the wrong error code: %v", etcdErr)
+	}
+	if etcdErr.Index < resp.Node.ModifiedIndex {
+		t.Fatalf("CompareAndDelete error carries a stale index: %v < %v",
+			etcdErr.Index, resp.Node.ModifiedIndex)
+	}
+}
+
+func TestPop(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("queue_foo", true)
+	}()
+
+	c.Delete("queue_foo", true)
+
+	if _, err := c.Pop("queue_foo"); err != ErrQueueEmpty {
+		t.Fatalf("Pop on a missing queue should fail with ErrQueueEmpty: %v", err)
+	}
+
+	for _, value := range []string{"a", "b", "c"} {
+		if _, err := c.CreateInOrder("queue_foo", value, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var lock sync.Mutex
+	popped := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := NewClient(nil)
+			for {
+				n, err := c.Pop("queue_foo")
+				if err == ErrQueueEmpty {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				lock.Lock()
+				popped[n.Value]++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !(len(popped) == 3 && popped["a"] == 1 && popped["b"] == 1 && popped["c"] == 1) {
+		t.Fatalf("every item should be popped exactly once: %v", popped)
+	}
+}
@@ -1,7 +1,18 @@
 package etcd
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
+// CompareAndSwap sets the given key to the given value, with the given
+// TTL, if its current value equals prevValue and its ModifiedIndex
+// equals prevIndex. An empty prevValue or a zero prevIndex is not
+// compared. As with Set, a ttl of 0 stores the new value without a TTL,
+// so a key which had one no longer expires. If the comparison fails, the
+// key is left as it was, and an *EtcdError with ErrCodeCompareFailed is
+// returned, carrying the current etcd index and the comparison that
+// failed in its Cause.
 func (c *Client) CompareAndSwap(key string, value string, ttl uint64,
 	prevValue string, prevIndex uint64) (*Response, error) {
 	raw, err := c.RawCompareAndSwap(key, value, ttl, prevValue, prevIndex, nil)
@@ -12,6 +23,21 @@ func (c *Client) CompareAndSwap(key string, value string, ttl uint64,
 	return raw.Unmarshal()
 }
 
+// CompareAndSwapTTL sets the given key to the given value and resets its
+// TTL to ttl, in a single request, if its ModifiedIndex equals prevIndex.
+// It renews a lease along with the value its holder keeps in it; the
+// ModifiedIndex of the returned node is the prevIndex of the next renewal.
+// Neither ttl nor prevIndex may be zero. If the comparison fails, an
+// *EtcdError with ErrCodeCompareFailed is returned and the key is left as
+// it was.
+func (c *Client) CompareAndSwapTTL(key, value string, ttl, prevIndex uint64) (*Response, error) {
+	if ttl == 0 || prevIndex == 0 {
+		return nil, fmt.Errorf("You must give both a ttl and a prevIndex.")
+	}
+
+	return c.CompareAndSwap(key, value, ttl, "", prevIndex)
+}
+
 func (c *Client) RawCompareAndSwap(key string, value string, ttl uint64,
 	prevValue string, prevIndex uint64, prevExist *bool) (*RawResponse, error) {
 	if prevValue == "" && prevIndex == 0 && prevExist == nil {
@@ -41,3 +67,134 @@ func (c *Client) RawCompareAndSwap(key string, value string, ttl uint64,
 
 	return raw, err
 }
+
+// SwapValues exchanges the values of the two given keys.
+//
+// This is best-effort rather than a transaction, which etcd v2 does not
+// offer: both keys are read, then each one is compare-and-swapped to the
+// other's value based on the observed index. If the second swap fails
+// because keyB changed in the meantime, the first one is rolled back,
+// unless keyA changed as well. Other clients may briefly see both keys
+// holding the same value. The remaining TTLs of the keys are kept.
+func (c *Client) SwapValues(keyA, keyB string) error {
+	respA, err := c.read(keyA, false, false)
+	if err != nil {
+		return err
+	}
+
+	respB, err := c.read(keyB, false, false)
+	if err != nil {
+		return err
+	}
+
+	a, b := respA.Node, respB.Node
+
+	swappedA, err := c.CompareAndSwap(keyA, b.Value, uint64(a.TTL), "", a.ModifiedIndex)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.CompareAndSwap(keyB, a.Value, uint64(b.TTL), "", b.ModifiedIndex)
+	if err != nil {
+		// without the node of the swap, keyA is compared by value
+		prevValue, prevIndex := "", uint64(0)
+		if swappedA.Node != nil {
+			prevIndex = swappedA.Node.ModifiedIndex
+		} else {
+			prevValue = b.Value
+		}
+		_, rollbackErr := c.CompareAndSwap(keyA, a.Value, uint64(a.TTL), prevValue, prevIndex)
+		if rollbackErr != nil {
+			return fmt.Errorf("Swapping %v failed: %v; rolling back %v failed: %v",
+				keyB, err, keyA, rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Append atomically appends line to the newline-delimited list stored in
+// the given key, creating the key if it does not exist, and sets its TTL
+// to ttl. The current value is read and then compare-and-swapped, which
+// is retried until no other client changed the key in between.
+//
+// The whole list is read and written on every call, and concurrent
+// appenders keep conflicting with each other, so this only suits small
+// lists with few writers. Values are also bound by the size limit of the
+// etcd server. For queues, prefer CreateInOrder, which creates one key
+// per item.
+func (c *Client) Append(key string, line string, ttl uint64) (*Response, error) {
+	for {
+		resp, err := c.read(key, false, false)
+		if err != nil {
+			if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+				return nil, err
+			}
+
+			resp, err = c.Create(key, line, ttl)
+			if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyAlreadyExists {
+				logger.Debug("append.retry ", key)
+				continue
+			}
+			return resp, err
+		}
+
+		value := line
+		if resp.Node.Value != "" {
+			value = resp.Node.Value + "\n" + line
+		}
+
+		resp, err = c.CompareAndSwap(key, value, ttl, "", resp.Node.ModifiedIndex)
+		if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeCompareFailed {
+			logger.Debug("append.retry ", key)
+			continue
+		}
+		return resp, err
+	}
+}
+
+// Increment atomically adds delta to the integer stored in the given key,
+// and returns the new value, e.g. to count events or hand out sequence
+// numbers. A missing key is created with delta as its value. The TTL of
+// the key is set to ttl. Like Append, the current value is read and then
+// compare-and-swapped, which is retried until no other client changed
+// the key in between.
+//
+// An error is returned if the current value is not a decimal integer.
+func (c *Client) Increment(key string, delta int64, ttl uint64) (int64, error) {
+	for {
+		resp, err := c.read(key, false, false)
+		if err != nil {
+			if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+				return 0, err
+			}
+
+			_, err = c.Create(key, strconv.FormatInt(delta, 10), ttl)
+			if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyAlreadyExists {
+				logger.Debug("increment.retry ", key)
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			return delta, nil
+		}
+
+		current, err := strconv.ParseInt(resp.Node.Value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("The value of %v is not an integer: %q", key, resp.Node.Value)
+		}
+
+		value := current + delta
+		_, err = c.CompareAndSwap(key, strconv.FormatInt(value, 10), ttl, "", resp.Node.ModifiedIndex)
+		if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeCompareFailed {
+			logger.Debug("increment.retry ", key)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return value, nil
+	}
+}
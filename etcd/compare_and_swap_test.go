@@ -1,6 +1,9 @@
 package etcd
 
 import (
+	"net/http"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -55,3 +58,214 @@ func TestCompareAndSwap(t *testing.T) {
 		t.Fatalf("CompareAndSwap 4 should have failed.  The response is: %#v", resp)
 	}
 }
+
+func TestCompareAndSwapReservedCharacters(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	c.Set("foo", "a=b&c", 5)
+
+	// prevValue must be percent-encoded in the query string,
+	// otherwise the server would see prevValue=a and an option b.
+	resp, err := c.CompareAndSwap("foo", "d+e f", 5, "a=b&c", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "d+e f" && resp.PrevNode.Value == "a=b&c") {
+		t.Fatalf("CompareAndSwap with reserved characters failed: %#v", resp)
+	}
+
+	resp, err = c.CompareAndSwap("foo", "again", 5, "d+e f", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "again" {
+		t.Fatalf("CompareAndSwap with reserved characters failed: %#v", resp)
+	}
+}
+
+func TestSwapValues(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("fooA", true)
+		c.Delete("fooB", true)
+	}()
+
+	c.Set("fooA", "a", 5)
+	c.Set("fooB", "b", 5)
+
+	if err := c.SwapValues("fooA", "fooB"); err != nil {
+		t.Fatal(err)
+	}
+
+	respA, _ := c.Get("fooA", false, false)
+	respB, _ := c.Get("fooB", false, false)
+	if !(respA.Node.Value == "b" && respB.Node.Value == "a") {
+		t.Fatalf("SwapValues failed: %#v %#v", respA.Node, respB.Node)
+	}
+	if !(respA.Node.TTL > 0 && respB.Node.TTL > 0) {
+		t.Fatalf("SwapValues should keep the TTLs: %#v %#v", respA.Node, respB.Node)
+	}
+
+	// Change fooB right before fooA gets swapped, so that the swap
+	// of fooB fails and fooA has to be rolled back.
+	other := NewClient(nil)
+	tr := c.httpClient.Transport
+	c.httpClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "PUT" && req.URL.Path == "/v2/keys/fooA" {
+			if _, err := other.Set("fooB", "intruder", 5); err != nil {
+				t.Fatal(err)
+			}
+			c.httpClient.Transport = tr
+		}
+		return tr.RoundTrip(req)
+	})
+
+	if err := c.SwapValues("fooA", "fooB"); err == nil {
+		t.Fatal("SwapValues should fail when a key changes concurrently")
+	}
+
+	respA, _ = c.Get("fooA", false, false)
+	respB, _ = c.Get("fooB", false, false)
+	if !(respA.Node.Value == "b" && respB.Node.Value == "intruder") {
+		t.Fatalf("SwapValues should have rolled back: %#v %#v", respA.Node, respB.Node)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("append_foo", true)
+	}()
+
+	c.Delete("append_foo", true)
+
+	resp, err := c.Append("append_foo", "a", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "a" {
+		t.Fatalf("Append 1 failed: %#v", resp.Node)
+	}
+
+	// Append a line from another client right before the swap, so that
+	// the first attempt conflicts and has to be retried.
+	other := NewClient(nil)
+	tr := c.httpClient.Transport
+	c.httpClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "PUT" {
+			c.httpClient.Transport = tr
+			if _, err := other.Append("append_foo", "b", 5); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return tr.RoundTrip(req)
+	})
+
+	resp, err = c.Append("append_foo", "c", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "a\nb\nc" {
+		t.Fatalf("Append 2 failed: %q", resp.Node.Value)
+	}
+	if resp.Node.TTL <= 0 {
+		t.Fatalf("Append 2 should set the TTL: %#v", resp.Node)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("increment_foo", true)
+	}()
+
+	c.Delete("increment_foo", true)
+
+	// Every increment gets its own value, adding up to the sum
+	const workers, increments = 5, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				if _, err := c.Increment("increment_foo", 2, 5); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	value, err := c.Increment("increment_foo", -100, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 0 {
+		t.Fatalf("Increment returned %v, expected 0", value)
+	}
+
+	c.Set("increment_foo", "abc", 5)
+	if _, err := c.Increment("increment_foo", 1, 5); err == nil {
+		t.Fatal("Increment should fail on a value which is not an integer")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCompareAndSwapTTL(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("lease_foo", true)
+	}()
+
+	resp, err := c.Set("lease_foo", "a", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := resp.Node.ModifiedIndex
+
+	var methods []string
+	c.Use(func(req *http.Request, next func() (*http.Response, error)) (*http.Response, error) {
+		methods = append(methods, req.Method)
+		return next()
+	})
+
+	resp, err = c.CompareAndSwapTTL("lease_foo", "b", 30, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "b" && resp.Node.TTL == 30 && resp.PrevNode.Value == "a") {
+		t.Fatalf("CompareAndSwapTTL did not swap the value and the TTL: %#v", resp)
+	}
+	if !reflect.DeepEqual(methods, []string{"PUT"}) {
+		t.Fatalf("CompareAndSwapTTL sent %q, expected a single PUT", methods)
+	}
+
+	// index is stale now
+	_, err = c.CompareAndSwapTTL("lease_foo", "c", 60, index)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeCompareFailed {
+		t.Fatalf("CompareAndSwapTTL with a stale index returned %v, expected a compare failure", err)
+	}
+
+	resp, err = c.Get("lease_foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "b" && resp.Node.TTL <= 30) {
+		t.Fatalf("the rejected CompareAndSwapTTL changed the key: %#v", resp.Node)
+	}
+}
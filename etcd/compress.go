@@ -0,0 +1,63 @@
+package etcd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// compressedPrefix marks the values written by SetCompressed.
+const compressedPrefix = "gzip+base64:"
+
+// Errors introduced by compressed values
+var (
+	ErrNotCompressed = errors.New("The value was not written by SetCompressed")
+)
+
+// SetCompressed sets the given key to the given value, gzipped and
+// base64-encoded, which saves space in etcd for large compressible
+// values such as JSON documents. The value must be read back with
+// GetCompressed.
+func (c *Client) SetCompressed(key string, value []byte, ttl uint64) (*Response, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	encoded := compressedPrefix + base64.StdEncoding.EncodeToString(buf.Bytes())
+	return c.Set(key, encoded, ttl)
+}
+
+// GetCompressed gets the value of the given key, which was written by
+// SetCompressed. ErrNotCompressed is returned for any other value.
+func (c *Client) GetCompressed(key string) ([]byte, error) {
+	resp, err := c.read(key, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(resp.Node.Value, compressedPrefix) {
+		return nil, ErrNotCompressed
+	}
+
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.Node.Value, compressedPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,36 @@
+package etcd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSetCompressed(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	value := bytes.Repeat([]byte(`{"name":"foo","enabled":true},`), 1000)
+
+	resp, err := c.SetCompressed("foo", value, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Node.Value) >= len(value) {
+		t.Fatalf("the stored value should be smaller: %v >= %v", len(resp.Node.Value), len(value))
+	}
+
+	actual, err := c.GetCompressed("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, value) {
+		t.Fatal("GetCompressed did not return the original value")
+	}
+
+	c.Set("foo", "bar", 5)
+	if _, err := c.GetCompressed("foo"); err != ErrNotCompressed {
+		t.Fatalf("GetCompressed should fail on a plain value: %v", err)
+	}
+}
@@ -1,5 +1,11 @@
 package etcd
 
+import "sync"
+
+// multiKeyConcurrency is how many requests MultiDelete and RefreshAll
+// send at once.
+const multiKeyConcurrency = 8
+
 // Delete deletes the given key.
 //
 // When recursive set to false, if the key points to a
@@ -30,6 +36,18 @@ func (c *Client) DeleteDir(key string) (*Response, error) {
 	return raw.Unmarshal()
 }
 
+// DeleteWithOptions deletes the given key with the given options,
+// see NewDeleteOptions.
+func (c *Client) DeleteWithOptions(key string, options Options) (*Response, error) {
+	raw, err := c.delete(key, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return raw.Unmarshal()
+}
+
 func (c *Client) RawDelete(key string, recursive bool, dir bool) (*RawResponse, error) {
 	ops := Options{
 		"recursive": recursive,
@@ -38,3 +56,42 @@ func (c *Client) RawDelete(key string, recursive bool, dir bool) (*RawResponse,
 
 	return c.delete(key, ops)
 }
+
+// MultiDelete deletes the given keys, a few at a time. A key that does
+// not exist counts as deleted. The returned slice holds the error for
+// each key, in the same order, and nil for every key that was deleted.
+func (c *Client) MultiDelete(keys []string) []error {
+	return forEachKey(keys, func(key string) error {
+		_, err := c.Delete(key, false)
+		if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// forEachKey calls fn for each of the given keys, a few at a time, and
+// returns the errors it returned, in the same order as the keys.
+func forEachKey(keys []string, fn func(key string) error) []error {
+	errs := make([]error, len(keys))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < multiKeyConcurrency && w < len(keys); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(keys[i])
+			}
+		}()
+	}
+
+	for i := range keys {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
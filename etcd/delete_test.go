@@ -1,6 +1,8 @@
 package etcd
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -79,3 +81,61 @@ func TestDeleteAll(t *testing.T) {
 			"The response was: %v", resp)
 	}
 }
+
+func TestDeleteWithoutBody(t *testing.T) {
+	var req *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		w.Write([]byte(`{"action":"delete","node":{"key":"/foo"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	_, err := c.Delete("foo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Method != "DELETE" {
+		t.Fatalf("expected a DELETE request, got %v", req.Method)
+	}
+	if !(req.URL.Query().Get("recursive") == "true" && req.URL.Query().Get("dir") == "false") {
+		t.Fatalf("options should be in the query string: %v", req.URL)
+	}
+	if req.ContentLength != 0 || req.Header.Get("Content-Type") != "" {
+		t.Fatalf("DELETE should not have a body: %v %v",
+			req.ContentLength, req.Header.Get("Content-Type"))
+	}
+}
+
+func TestMultiDelete(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("multi_foo", true)
+	}()
+
+	c.Set("multi_foo/a", "1", 5)
+	c.Set("multi_foo/c", "3", 5)
+	c.Set("multi_foo/dir/d", "4", 5)
+
+	keys := []string{"multi_foo/a", "multi_foo/b", "multi_foo/dir", "multi_foo/c"}
+	errs := c.MultiDelete(keys)
+	if len(errs) != len(keys) {
+		t.Fatalf("MultiDelete returned %v errors for %v keys", len(errs), len(keys))
+	}
+
+	// Only the directory cannot be deleted as a key
+	for i, err := range errs {
+		if (err != nil) != (keys[i] == "multi_foo/dir") {
+			t.Fatalf("unexpected error for %v: %v", keys[i], err)
+		}
+	}
+
+	resp, err := c.Get("multi_foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(len(resp.Node.Nodes) == 1 && resp.Node.Nodes[0].Key == "/multi_foo/dir") {
+		t.Fatalf("MultiDelete failed: %#v", resp.Node.Nodes)
+	}
+}
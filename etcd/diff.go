@@ -0,0 +1,71 @@
+package etcd
+
+import (
+	"strings"
+)
+
+// Diff gets the trees under the two given prefixes, recursively, and
+// compares their keys relative to the prefixes, e.g. to find the drift
+// between the config of two environments. It returns the keys which
+// only exist under prefixA with their values, those which only exist
+// under prefixB, and those whose values differ, as pairs of the values
+// under prefixA and prefixB. Directories are compared through the keys
+// they contain; a missing prefix is treated as an empty tree.
+func (c *Client) Diff(prefixA, prefixB string) (onlyA, onlyB map[string]string, changed map[string][2]string, err error) {
+	a, err := c.getRelativeValues(prefixA)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	b, err := c.getRelativeValues(prefixB)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	onlyA = make(map[string]string)
+	onlyB = make(map[string]string)
+	changed = make(map[string][2]string)
+
+	for key, valueA := range a {
+		valueB, ok := b[key]
+		if !ok {
+			onlyA[key] = valueA
+		} else if valueA != valueB {
+			changed[key] = [2]string{valueA, valueB}
+		}
+	}
+	for key, valueB := range b {
+		if _, ok := a[key]; !ok {
+			onlyB[key] = valueB
+		}
+	}
+
+	return onlyA, onlyB, changed, nil
+}
+
+// getRelativeValues gets the values of the keys under the given prefix,
+// by their key relative to the prefix.
+func (c *Client) getRelativeValues(prefix string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	resp, err := c.read(prefix, false, true)
+	if err != nil {
+		if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyNotFound {
+			return values, nil
+		}
+		return nil, err
+	}
+
+	root := resp.Node.Key
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if !n.Dir {
+			values[strings.TrimPrefix(n.Key, root)] = n.Value
+		}
+		for _, child := range n.Nodes {
+			walk(child)
+		}
+	}
+	walk(resp.Node)
+
+	return values, nil
+}
@@ -0,0 +1,48 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("diff_staging", true)
+		c.Delete("diff_prod", true)
+	}()
+
+	c.Delete("diff_staging", true)
+	c.Delete("diff_prod", true)
+
+	c.Set("diff_staging/same", "1", 100)
+	c.Set("diff_staging/db/host", "db-staging", 100)
+	c.Set("diff_staging/feature", "on", 100)
+	c.Set("diff_prod/same", "1", 100)
+	c.Set("diff_prod/db/host", "db-prod", 100)
+	c.Set("diff_prod/db/replicas", "3", 100)
+
+	onlyA, onlyB, changed, err := c.Diff("diff_staging", "/diff_prod/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(onlyA, map[string]string{"/feature": "on"}) {
+		t.Fatalf("unexpected keys only in the first tree: %v", onlyA)
+	}
+	if !reflect.DeepEqual(onlyB, map[string]string{"/db/replicas": "3"}) {
+		t.Fatalf("unexpected keys only in the second tree: %v", onlyB)
+	}
+	expected := map[string][2]string{"/db/host": {"db-staging", "db-prod"}}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Fatalf("unexpected changed keys: %v", changed)
+	}
+
+	// A missing tree is empty
+	onlyA, onlyB, changed, err = c.Diff("diff_staging", "diff_missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(len(onlyA) == 3 && len(onlyB) == 0 && len(changed) == 0) {
+		t.Fatalf("Diff against a missing tree failed: %v %v %v", onlyA, onlyB, changed)
+	}
+}
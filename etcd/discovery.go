@@ -0,0 +1,66 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// discovery bounds an administrative operation, such as syncing the
+// cluster, by Client.DiscoveryTimeout.
+type discovery struct {
+	timeout  time.Duration
+	deadline time.Time
+	// cancel is closed at the deadline, to cancel the pending requests
+	cancel chan bool
+	timer  *time.Timer
+}
+
+// startDiscovery starts the clock for an administrative operation. The
+// returned discovery must be stopped once the operation completed.
+func (c *Client) startDiscovery() *discovery {
+	d := &discovery{timeout: c.DiscoveryTimeout}
+	if d.timeout > 0 {
+		d.deadline = time.Now().Add(d.timeout)
+		d.cancel = make(chan bool)
+		d.timer = time.AfterFunc(d.timeout, func() {
+			close(d.cancel)
+		})
+	}
+	return d
+}
+
+func (d *discovery) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+// expired reports whether the deadline has passed.
+func (d *discovery) expired() bool {
+	return !d.deadline.IsZero() && !time.Now().Before(d.deadline)
+}
+
+// httpClient returns a copy of client whose requests time out at the
+// deadline, if any.
+func (d *discovery) httpClient(client *http.Client) *http.Client {
+	if d.deadline.IsZero() {
+		return client
+	}
+
+	bounded := *client
+	bounded.Timeout = time.Until(d.deadline)
+	if bounded.Timeout <= 0 {
+		bounded.Timeout = time.Nanosecond
+	}
+	return &bounded
+}
+
+// err turns the cancellation of a request at the deadline into an error
+// saying so.
+func (d *discovery) err(err error) error {
+	if err == ErrRequestCancelled && d.expired() {
+		return fmt.Errorf("Timed out after %v", d.timeout)
+	}
+	return err
+}
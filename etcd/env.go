@@ -0,0 +1,55 @@
+package etcd
+
+import (
+	"path"
+	"strings"
+)
+
+// GetEnv gets every key under the given prefix, recursively, and returns
+// them as NAME=value pairs as found in os.Environ, e.g. to configure a
+// child process.
+//
+// The name is derived from the last segment of the key only:
+// letters are uppercased, anything but letters, digits and underscores
+// is replaced by an underscore, and an underscore is prepended if the
+// name would start with a digit. For instance /config/db/max-conns
+// becomes MAX_CONNS. Keys in different directories may thus end up with
+// the same name; the pairs are sorted by key, so a later key takes
+// precedence when the result is handed to exec.Cmd.
+func (c *Client) GetEnv(prefix string) ([]string, error) {
+	resp, err := c.read(prefix, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if !n.Dir {
+			env = append(env, envName(path.Base(n.Key))+"="+n.Value)
+			return
+		}
+		for _, child := range n.Nodes {
+			walk(child)
+		}
+	}
+	walk(resp.Node)
+
+	return env, nil
+}
+
+// envName turns the given key segment into a valid environment
+// variable name as described in GetEnv.
+func envName(segment string) string {
+	name := []byte(strings.ToUpper(segment))
+	for i, b := range name {
+		if !(b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_') {
+			name[i] = '_'
+		}
+	}
+
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "_" + string(name)
+	}
+	return string(name)
+}
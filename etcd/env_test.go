@@ -0,0 +1,32 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEnv(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("envDir", true)
+	}()
+
+	c.Set("envDir/host", "localhost", 5)
+	c.Set("envDir/db/max-conns", "10", 5)
+	c.Set("envDir/db/2fa.enabled", "true", 5)
+	c.SetDir("envDir/empty", 5)
+
+	env, err := c.GetEnv("envDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"_2FA_ENABLED=true",
+		"MAX_CONNS=10",
+		"HOST=localhost",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("(actual) %v != (expected) %v", env, expected)
+	}
+}
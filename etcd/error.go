@@ -6,7 +6,12 @@ import (
 )
 
 const (
-	ErrCodeEtcdNotReachable = 501
+	ErrCodeKeyNotFound       = 100
+	ErrCodeCompareFailed     = 101
+	ErrCodeNotDir            = 104
+	ErrCodeKeyAlreadyExists  = 105
+	ErrCodeEventIndexCleared = 401
+	ErrCodeEtcdNotReachable  = 501
 )
 
 var (
@@ -0,0 +1,142 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// exportedTree is the document written by Export.
+type exportedTree struct {
+	Nodes []exportedNode `json:"nodes"`
+}
+
+// exportedNode is a key, or an empty directory, of an exported tree.
+type exportedNode struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	Dir   bool   `json:"dir,omitempty"`
+}
+
+// Export reads the tree under the given prefix, recursively, and returns
+// it as a JSON document listing every key with its value, sorted by key.
+// Empty directories are listed as well, so that Import restores them;
+// other directories are implied by their keys. TTLs and indexes are not
+// exported.
+func (c *Client) Export(prefix string) ([]byte, error) {
+	resp, err := c.read(prefix, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := exportedTree{Nodes: []exportedNode{}}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if !n.Dir || len(n.Nodes) == 0 {
+			tree.Nodes = append(tree.Nodes, newExportedNode(n))
+			return
+		}
+		for _, child := range n.Nodes {
+			walk(child)
+		}
+	}
+	walk(resp.Node)
+
+	return json.Marshal(tree)
+}
+
+// ConsistentSnapshot reads the tree under the given prefix, recursively
+// and sorted, with a quorum read, and returns it along with the etcd
+// index it was read at, from the X-Etcd-Index of the response, for a
+// backup to record. Watching from the index after it picks up the
+// changes made since.
+//
+// etcd v2 has no snapshots, so this is no more isolated than a recursive
+// Get: writes concurrent with the read are in the tree or not depending
+// on whether the machine applied them before reading its store, which the
+// returned index tells. Nothing holds the tree at that index afterwards,
+// and once etcd dropped the index from its event history, the changes
+// since it can no longer be watched.
+func (c *Client) ConsistentSnapshot(prefix string) (*Response, uint64, error) {
+	options := Options{
+		"recursive": true,
+		"sorted":    true,
+		"quorum":    true,
+	}
+
+	resp, err := c.readWithOptions(prefix, options)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return resp, resp.EtcdIndex, nil
+}
+
+// ExportTo writes the same document as Export to w, but streams the tree
+// while it is received, see StreamTree, so that exporting a huge tree
+// does not need to hold it in memory.
+func (c *Client) ExportTo(prefix string, w io.Writer) error {
+	if _, err := io.WriteString(w, `{"nodes":[`); err != nil {
+		return err
+	}
+
+	first := true
+	err := c.streamTree(prefix, func(n *Node) error {
+		b, err := json.Marshal(newExportedNode(n))
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}")
+	return err
+}
+
+// newExportedNode converts a key or an empty directory for an export.
+func newExportedNode(n *Node) exportedNode {
+	if n.Dir {
+		return exportedNode{Key: n.Key, Dir: true}
+	}
+	return exportedNode{Key: n.Key, Value: n.Value}
+}
+
+// Import writes back the keys and directories of a document returned by
+// Export, with the given ttl. Existing keys are overwritten; keys that
+// are not part of the document are left alone.
+func (c *Client) Import(data []byte, ttl uint64) error {
+	var tree exportedTree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return fmt.Errorf("Invalid export: %v", err)
+	}
+
+	for _, n := range tree.Nodes {
+		var err error
+		if n.Dir {
+			_, err = c.CreateDir(n.Key, ttl)
+			if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyAlreadyExists {
+				err = nil
+			}
+		} else {
+			_, err = c.Set(n.Key, n.Value, ttl)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Cannot import %v: %v", n.Key, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("export_foo", true)
+	}()
+
+	c.Delete("export_foo", true)
+	c.Set("export_foo/a", "1", 100)
+	c.Set("export_foo/dir/b", "2\n+", 100)
+	c.Set("export_foo/dir/sub/c", "3", 100)
+	c.CreateDir("export_foo/empty", 100)
+
+	data, err := c.Export("export_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"nodes":[{"key":"/export_foo/a","value":"1"},` +
+		`{"key":"/export_foo/dir/b","value":"2\n+"},` +
+		`{"key":"/export_foo/dir/sub/c","value":"3"},` +
+		`{"key":"/export_foo/empty","dir":true}]}`
+	if string(data) != expected {
+		t.Fatalf("Export failed: %s", data)
+	}
+
+	c.Delete("export_foo", true)
+
+	if err := c.Import(data, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := c.Export("export_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, data) {
+		t.Fatalf("Import did not restore the tree: %s", restored)
+	}
+
+	// Importing onto the existing tree overwrites it
+	if err := c.Import(data, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Import([]byte("not json"), 100); err == nil {
+		t.Fatal("Import should fail on an invalid document")
+	}
+}
+
+func TestExportTo(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("export_foo", true)
+	}()
+
+	c.Delete("export_foo", true)
+	for i := 0; i < 200; i++ {
+		c.Set(fmt.Sprintf("export_foo/dir%d/key%03d", i%7, i), strings.Repeat("v", i), 100)
+	}
+	c.CreateDir("export_foo/empty", 100)
+
+	var buf bytes.Buffer
+	if err := c.ExportTo("export_foo", &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var tree exportedTree
+	if err := json.Unmarshal(buf.Bytes(), &tree); err != nil {
+		t.Fatalf("ExportTo wrote invalid JSON: %v", err)
+	}
+	if len(tree.Nodes) != 201 {
+		t.Fatalf("ExportTo wrote %v nodes, expected 201", len(tree.Nodes))
+	}
+
+	// The document is the same as the one of Export
+	data, err := c.Export("export_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("ExportTo and Export differ:\n%s\n%s", buf.Bytes(), data)
+	}
+
+	buf.Reset()
+	if err := c.ExportTo("export_missing", &buf); err == nil {
+		t.Fatal("ExportTo should fail on a missing prefix")
+	}
+}
+
+func TestConsistentSnapshot(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("snapshot_foo", true)
+	}()
+
+	c.Delete("snapshot_foo", true)
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("snapshot_foo/dir%v/k", i), fmt.Sprint(i), 5)
+	}
+
+	var queries []string
+	c.Use(func(req *http.Request, next func() (*http.Response, error)) (*http.Response, error) {
+		queries = append(queries, req.URL.RawQuery)
+		return next()
+	})
+
+	resp, index, err := c.ConsistentSnapshot("snapshot_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(index > 0 && index == resp.EtcdIndex) {
+		t.Fatalf("ConsistentSnapshot returned index %v, expected the X-Etcd-Index %v", index, resp.EtcdIndex)
+	}
+	if len(queries) != 1 || !strings.Contains(queries[0], "quorum=true") {
+		t.Fatalf("ConsistentSnapshot sent %q, expected a quorum read", queries)
+	}
+
+	if leaves := resp.Node.CountLeaves(); leaves != 10 {
+		t.Fatalf("the snapshot holds %v keys, expected 10", leaves)
+	}
+	for i, dir := range resp.Node.Nodes {
+		if v := dir.Nodes[0].Value; v != fmt.Sprint(i) {
+			t.Fatalf("the snapshot holds %v under %v, expected %v", v, dir.Key, i)
+		}
+		if dir.Nodes[0].ModifiedIndex > index {
+			t.Fatalf("%v was modified at %v, after the snapshot index %v", dir.Key, dir.Nodes[0].ModifiedIndex, index)
+		}
+	}
+}
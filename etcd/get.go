@@ -1,20 +1,323 @@
 package etcd
 
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
 // Get gets the file or directory associated with the given key.
 // If the key points to a directory, files and directories under
 // it will be returned in sorted or unsorted order, depending on
-// the sort flag.
+// the sort flag. Unsorted nodes are kept in the order the server
+// sent them.
 // If recursive is set to false, contents under child directories
 // will not be returned.
 // If recursive is set to true, all the contents will be returned.
 func (c *Client) Get(key string, sort, recursive bool) (*Response, error) {
+	// strongly consistent reads are always sent to the leader
+	cache := c.cache
+	if c.config.Consistency == STRONG_CONSISTENCY {
+		cache = nil
+	}
+
+	if raw := cache.get(key, sort, recursive); raw != nil {
+		logger.Debug("get.cached ", key)
+		return c.unmarshalRead(raw)
+	}
+
+	generation := cache.start()
+	raw, err := c.RawGet(key, sort, recursive)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if raw.StatusCode == http.StatusOK {
+		cache.put(key, sort, recursive, generation, raw)
+	}
+
+	return c.unmarshalRead(raw)
+}
+
+// read gets the given key like Get, but never from the cache nor with
+// TrimValues applied, for the helpers which act on what etcd holds.
+func (c *Client) read(key string, sort, recursive bool) (*Response, error) {
 	raw, err := c.RawGet(key, sort, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalNode(raw)
+}
 
+// readWithOptions is GetWithOptions without TrimValues, see read.
+func (c *Client) readWithOptions(key string, options Options) (*Response, error) {
+	raw, err := c.get(key, options)
 	if err != nil {
 		return nil, err
 	}
 
-	return raw.Unmarshal()
+	return unmarshalNode(raw)
+}
+
+// unmarshalNode unmarshals a response which must have a node, which an
+// empty body does not, see ErrNoNode.
+func unmarshalNode(raw *RawResponse) (*Response, error) {
+	resp, err := raw.Unmarshal()
+	if err == nil && resp.Node == nil {
+		return nil, ErrNoNode
+	}
+	return resp, err
+}
+
+// GetLimited is like Get, but keeps at most maxNodes leaves of the
+// returned tree, walking it depth-first, and sets Truncated on the
+// response if anything was left out. Callers can use it to guard
+// against huge listings. A maxNodes of 0 or less sets no limit, as for
+// Get.
+// etcd sends the whole tree at once, so the cap is applied after it
+// was received and parsed.
+func (c *Client) GetLimited(key string, sort, recursive bool, maxNodes int) (*Response, error) {
+	resp, err := c.Get(key, sort, recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxNodes > 0 && resp.Node != nil {
+		_, resp.Truncated = resp.Node.truncate(maxNodes)
+	}
+	return resp, nil
+}
+
+// GetFresh gets the given key from a machine which has caught up with
+// at least minIndex, as reported by its X-Etcd-Index. The followers are
+// asked first, and the leader after them, so that reads of bounded
+// staleness rarely cost a round to the leader. Machines are asked in
+// turn, waiting for the backoff of the client between them, see
+// RetryBackoff, until a fresh enough answer is found or CheckRetry gives
+// up. The read takes a single slot of MaxConcurrentRequests.
+func (c *Client) GetFresh(key string, minIndex uint64) (*Response, error) {
+	if err := c.checkKey(key); err != nil {
+		return nil, err
+	}
+
+	checkRetry := c.retryPolicy()
+
+	if c.MaxConcurrentRequests > 0 {
+		slots := c.limiter.acquire(c.MaxConcurrentRequests, nil)
+		defer c.limiter.release(slots)
+	}
+
+	// followers first, then the leader
+	var machines []string
+	for _, machine := range c.cluster.Machines {
+		if machine != c.cluster.Leader {
+			machines = append(machines, machine)
+		}
+	}
+	machines = append(machines, c.cluster.Leader)
+
+	backoff := c.newBackoff()
+	for numReqs := 1; ; numReqs++ {
+		if numReqs > 1 {
+			time.Sleep(backoff.next())
+		}
+
+		machine := machines[(numReqs-1)%len(machines)]
+		logger.Debug("get.fresh.from ", machine)
+
+		resp, raw, err := c.getFrom(machine, key)
+		lastResp := http.Response{}
+		if resp != nil {
+			lastResp = *resp
+		}
+		if err == nil {
+			var index uint64
+			index, err = raw.etcdIndex()
+			if err == nil && index >= minIndex {
+				return c.unmarshalRead(raw)
+			}
+			if err == nil {
+				err = fmt.Errorf("%v is at index %v, expected at least %v",
+					machine, index, minIndex)
+			}
+		}
+
+		logger.Debug("get.fresh.failed ", err)
+		if checkErr := checkRetry(c.cluster, numReqs, lastResp, err); checkErr != nil {
+			return nil, checkErr
+		}
+	}
+}
+
+// GetWithMaxStaleness gets the given key from a follower, like a read
+// under WEAK_CONSISTENCY, as long as the follower holds every change the
+// leader had applied maxAge ago, and from the leader otherwise. The raft
+// index of the leader is read with a HEAD request and trusted for
+// maxAge, so that a burst of reads costs the leader a single request
+// without a body. The answer of the follower is stale if its raft index
+// is behind that one, or behind any raft index the client saw since.
+//
+// Only the clock of the client is involved, not those of the machines.
+// The bound is loose by the time the leader takes to answer the HEAD,
+// and a maxAge of 0 asks the leader for its index on every read.
+func (c *Client) GetWithMaxStaleness(key string, maxAge time.Duration) (*Response, error) {
+	if err := c.checkKey(key); err != nil {
+		return nil, err
+	}
+
+	if len(c.cluster.Machines) > 1 {
+		minIndex, err := c.leaderRaftIndex(maxAge)
+		if err != nil {
+			logger.Debug("get.leader.index failed: ", err)
+			return c.GetWithOptions(key, Options{"consistent": true})
+		}
+		if known := atomic.LoadUint64(&c.cluster.raftIndex); known > minIndex {
+			minIndex = known
+		}
+
+		follower := c.cluster.pickOther(c.cluster.Leader)
+		_, raw, err := c.getFrom(follower, key)
+		if err == nil && validHttpStatusCode[raw.StatusCode] {
+			index, err := strconv.ParseUint(raw.Header.Get("X-Raft-Index"), 10, 64)
+			if err == nil && index >= minIndex {
+				return c.unmarshalRead(raw)
+			}
+			logger.Debugf("get.stale from %v at raft index %v, expected %v", follower, index, minIndex)
+		} else if err != nil {
+			logger.Debug("get.from.follower failed: ", err)
+		}
+	}
+
+	return c.GetWithOptions(key, Options{"consistent": true})
+}
+
+// raftIndexSample is a raft index of the leader, and when it was asked
+// for, see GetWithMaxStaleness.
+type raftIndexSample struct {
+	index uint64
+	at    time.Time
+}
+
+// leaderRaftIndex returns a raft index the leader had reached at most
+// maxAge ago, asking the leader for its current one if the last one is
+// older.
+func (c *Client) leaderRaftIndex(maxAge time.Duration) (uint64, error) {
+	if sample, _ := c.leaderIndex.Load().(*raftIndexSample); sample != nil &&
+		timeNow().Sub(sample.at) < maxAge {
+		return sample.index, nil
+	}
+
+	// the index reached when the request is sent, at the latest
+	at := timeNow()
+	raw, err := c.SendRequest(NewRawRequest("HEAD", keyToPath("/"), nil, nil))
+	if err != nil {
+		return 0, err
+	}
+
+	index, err := strconv.ParseUint(raw.Header.Get("X-Raft-Index"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("The response has no X-Raft-Index header (status %v)", raw.StatusCode)
+	}
+	c.leaderIndex.Store(&raftIndexSample{index: index, at: at})
+	return index, nil
+}
+
+// getFrom gets the given key from the given machine only, rather than
+// from the leader.
+func (c *Client) getFrom(machine, key string) (*http.Response, *RawResponse, error) {
+	ops := Options{
+		"recursive": false,
+		"sorted":    false,
+	}
+	str, err := ops.toParameters(VALID_GET_OPTIONS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest("GET", c.getHttpPath(machine, keyToPath(key)+str), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	setCredentials(req, machine)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := newRawResponse(resp)
+	if err != nil {
+		return resp, nil, err
+	}
+	raw.decoder = c.Decoder
+	raw.aliases = c.FieldAliases
+	return resp, raw, nil
+}
+
+// GetIfModifiedSince gets the given key if it was modified after
+// knownIndex, typically the ModifiedIndex of a previous Get. Otherwise it
+// returns a nil Response and false.
+// etcd has no conditional GET, so the value is still transferred; this
+// only spares the caller from handling a value it already has.
+func (c *Client) GetIfModifiedSince(key string, knownIndex uint64) (*Response, bool, error) {
+	resp, err := c.read(key, false, false)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if resp.Node.ModifiedIndex <= knownIndex {
+		return nil, false, nil
+	}
+
+	return resp, true, nil
+}
+
+// GetWithOptions gets the given key with the given options,
+// see NewGetOptions.
+func (c *Client) GetWithOptions(key string, options Options) (*Response, error) {
+	raw, err := c.get(key, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.unmarshalRead(raw)
+}
+
+// unmarshalRead unmarshals the response of a public read, applying
+// TrimValues.
+func (c *Client) unmarshalRead(raw *RawResponse) (*Response, error) {
+	resp, err := raw.Unmarshal()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.TrimValues && resp.Node != nil {
+		resp.Node.trimValues()
+	}
+	return resp, nil
+}
+
+// CurrentIndex returns the current etcd index of the cluster; watching
+// from the index after it yields the changes from now on. Only the
+// headers of the root are requested, so no keys are transferred.
+func (c *Client) CurrentIndex() (uint64, error) {
+	raw, err := c.SendRequest(NewRawRequest("HEAD", keyToPath("/"), nil, nil))
+	if err != nil {
+		return 0, err
+	}
+
+	index := raw.Header.Get("X-Etcd-Index")
+	if index == "" {
+		return 0, fmt.Errorf("The response has no X-Etcd-Index header (status %v)", raw.StatusCode)
+	}
+	return strconv.ParseUint(index, 10, 64)
 }
 
 func (c *Client) RawGet(key string, sort, recursive bool) (*RawResponse, error) {
@@ -25,3 +328,156 @@ func (c *Client) RawGet(key string, sort, recursive bool) (*RawResponse, error)
 
 	return c.get(key, ops)
 }
+
+// GetWithAncestors gets the node associated with the given key along with
+// every directory above it, ordered from the top-level directory down to
+// the key itself. The root directory is not included.
+// Each node is fetched with its own non-recursive GET, so directories
+// only contain their direct children.
+func (c *Client) GetWithAncestors(key string) ([]*Node, error) {
+	var nodes []*Node
+
+	p := "/"
+	for _, segment := range strings.Split(path.Clean("/"+key), "/") {
+		if segment == "" {
+			continue
+		}
+		p = path.Join(p, segment)
+
+		resp, err := c.read(p, false, false)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, resp.Node)
+	}
+
+	return nodes, nil
+}
+
+// GetDirMeta gets the node of the given directory without its children,
+// for when only the attributes of the directory itself are of interest.
+// etcd always includes the direct children when getting a directory,
+// so they are dropped here rather than handed to the caller.
+func (c *Client) GetDirMeta(dir string) (*Node, error) {
+	resp, err := c.read(dir, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if !resp.Node.Dir {
+		return nil, fmt.Errorf("%v is not a directory", resp.Node.Key)
+	}
+
+	resp.Node.Nodes = nil
+	return resp.Node, nil
+}
+
+// ListSubdirs returns the names of the directories directly under the
+// given directory, in sorted order. Files are left out.
+func (c *Client) ListSubdirs(dir string) ([]string, error) {
+	resp, err := c.read(dir, true, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var subdirs []string
+	for _, child := range resp.Node.Nodes {
+		if child.Dir {
+			subdirs = append(subdirs, path.Base(child.Key))
+		}
+	}
+
+	return subdirs, nil
+}
+
+// CountWhere gets the tree under the given prefix, recursively, and
+// counts its leaf nodes for which pred returns true. As for
+// Node.CountLeaves, empty directories are leaves too; pred can tell
+// them apart with Node.Kind.
+func (c *Client) CountWhere(prefix string, pred func(n *Node) bool) (int, error) {
+	resp, err := c.read(prefix, false, true)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.Node.countLeavesWhere(pred), nil
+}
+
+// ChangedSince gets the tree under the given prefix, recursively, and
+// returns its leaf nodes modified after sinceIndex, sorted by key. A
+// system can thus pull what changed since its last sync, at the
+// EtcdIndex of the previous call, without watching the prefix. Note that
+// deleted keys are not reported, and that empty directories are leaves.
+func (c *Client) ChangedSince(prefix string, sinceIndex uint64) ([]*Node, error) {
+	resp, err := c.read(prefix, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Node.leavesWhere(func(n *Node) bool {
+		return n.ModifiedIndex > sinceIndex
+	}), nil
+}
+
+// ListWithTTL gets the tree under the given prefix, recursively, and
+// returns the remaining TTL, in seconds, of each of its leaf nodes, keyed
+// by their keys. Keys without a TTL are listed with -1. As for
+// ChangedSince, empty directories are leaves.
+func (c *Client) ListWithTTL(prefix string) (map[string]int64, error) {
+	resp, err := c.read(prefix, false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := resp.Node.leavesWhere(func(n *Node) bool {
+		return true
+	})
+
+	ttls := make(map[string]int64)
+	for _, n := range leaves {
+		if n.Expiration == nil {
+			ttls[n.Key] = -1
+		} else {
+			ttls[n.Key] = n.TTL
+		}
+	}
+	return ttls, nil
+}
+
+// ReferenceMarker starts the values which refer to another key, e.g.
+// "@ref:/config/current" points GetResolved to /config/current. The rest
+// of the value is the key referred to, taken from the root.
+const ReferenceMarker = "@ref:"
+
+// GetResolved gets the given key and, as long as its value is a reference
+// to another key, gets that key instead, following at most maxDepth
+// references. The response of the key holding the final value is
+// returned. A chain of references that comes back to one of its keys, or
+// is longer than maxDepth, is an error.
+func (c *Client) GetResolved(key string, maxDepth int) (*Response, error) {
+	chain := []string{path.Clean("/" + key)}
+
+	for {
+		resp, err := c.read(key, false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Node.Dir || !strings.HasPrefix(resp.Node.Value, ReferenceMarker) {
+			return resp, nil
+		}
+
+		key = path.Clean("/" + strings.TrimPrefix(resp.Node.Value, ReferenceMarker))
+		for _, seen := range chain {
+			if seen == key {
+				return nil, fmt.Errorf("Reference cycle: %v -> %v",
+					strings.Join(chain, " -> "), key)
+			}
+		}
+		if len(chain) > maxDepth {
+			return nil, fmt.Errorf("More than %v references from %v",
+				maxDepth, chain[0])
+		}
+		chain = append(chain, key)
+	}
+}
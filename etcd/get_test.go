@@ -1,8 +1,14 @@
 package etcd
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // cleanNode scrubs Expiration, ModifiedIndex and CreatedIndex of a node.
@@ -129,3 +135,672 @@ func TestGetAll(t *testing.T) {
 		t.Fatalf("(actual) %v != (expected) %v", result.Node.Nodes, expected)
 	}
 }
+
+func TestGetWithAncestors(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("a", true)
+	}()
+
+	c.Set("a/b/c", "v", 5)
+
+	nodes, err := c.GetWithAncestors("/a/b/c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"/a", "/a/b", "/a/b/c"}
+	if len(nodes) != len(expected) {
+		t.Fatalf("GetWithAncestors returned %v nodes, expected %v", len(nodes), len(expected))
+	}
+	for i, node := range nodes {
+		if node.Key != expected[i] {
+			t.Fatalf("node %v is %v, expected %v", i, node.Key, expected[i])
+		}
+	}
+	if !(nodes[0].Dir && nodes[1].Dir && nodes[2].Value == "v") {
+		t.Fatalf("GetWithAncestors failed: %v", nodes)
+	}
+
+	_, err = c.GetWithAncestors("a/b/nonexistent")
+	if err == nil {
+		t.Fatal("should not be able to get the ancestors of a non-exist key")
+	}
+}
+
+func TestGetDirMeta(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("fooDir", true)
+	}()
+
+	c.CreateDir("fooDir", 5)
+	c.Set("fooDir/k0", "v0", 5)
+	c.Set("fooDir/k1", "v1", 5)
+
+	node, err := c.GetDirMeta("fooDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !(node.Key == "/fooDir" && node.Dir && node.TTL > 0 && node.CreatedIndex > 0) {
+		t.Fatalf("GetDirMeta failed: %#v", node)
+	}
+	if node.Nodes != nil {
+		t.Fatalf("GetDirMeta should not return the children: %v", node.Nodes)
+	}
+
+	_, err = c.GetDirMeta("fooDir/k0")
+	if err == nil {
+		t.Fatal("should not be able to get the directory metadata of a key")
+	}
+}
+
+func TestGetLimited(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("fooDir", true)
+	}()
+
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("fooDir/k%v", i), "v", 5)
+		c.Set(fmt.Sprintf("fooDir/childDir/k%v", i), "v", 5)
+	}
+
+	result, err := c.GetLimited("fooDir", true, true, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated {
+		t.Fatal("GetLimited should have truncated the result")
+	}
+	if count := result.Node.CountLeaves(); count != 15 {
+		t.Fatalf("GetLimited returned %v leaves, expected 15", count)
+	}
+
+	result, err = c.GetLimited("fooDir", true, true, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Truncated {
+		t.Fatal("GetLimited should not have truncated the result")
+	}
+	if count := result.Node.CountLeaves(); count != 20 {
+		t.Fatalf("GetLimited returned %v leaves, expected 20", count)
+	}
+
+	// No limit at all
+	for _, maxNodes := range []int{0, -1} {
+		result, err = c.GetLimited("fooDir", true, true, maxNodes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count := result.Node.CountLeaves(); result.Truncated || count != 20 {
+			t.Fatalf("GetLimited with %v returned %v leaves, expected 20", maxNodes, count)
+		}
+	}
+}
+
+// newIndexServer returns a server answering every GET with a node
+// holding the given value, at the given etcd index.
+func newIndexServer(value string, index uint64, hits *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		w.Header().Set("X-Etcd-Index", fmt.Sprint(index))
+		fmt.Fprintf(w, `{"action":"get","node":{"key":"/foo","value":"%v"}}`, value)
+	}))
+}
+
+func TestGetFresh(t *testing.T) {
+	var leaderHits, followerHits int
+	leader := newIndexServer("fresh", 10, &leaderHits)
+	defer leader.Close()
+	follower := newIndexServer("stale", 5, &followerHits)
+	defer follower.Close()
+
+	c := NewClient([]string{leader.URL, follower.URL})
+
+	// The follower is fresh enough
+	resp, err := c.GetFresh("foo", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "stale" && followerHits == 1 && leaderHits == 0) {
+		t.Fatalf("GetFresh 1 failed: %#v", resp.Node)
+	}
+
+	// The follower is stale and must be skipped
+	resp, err = c.GetFresh("foo", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "fresh" && resp.EtcdIndex == 10 && followerHits == 2 && leaderHits == 1) {
+		t.Fatalf("GetFresh 2 failed: %#v", resp.Node)
+	}
+
+	// Nobody is fresh enough, and the machines are asked again only
+	// after backing off
+	c.RetryBackoff = 10 * time.Millisecond
+	start := time.Now()
+	_, err = c.GetFresh("foo", 20)
+	if err == nil {
+		t.Fatal("GetFresh should fail when no machine is fresh enough")
+	}
+	if retries := followerHits + leaderHits - 3; time.Since(start) < time.Duration(retries)*10*time.Millisecond {
+		t.Fatalf("GetFresh retried %v times without backing off, in %v", retries, time.Since(start))
+	}
+}
+
+func TestGetFreshMaxConcurrentRequests(t *testing.T) {
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("X-Etcd-Index", "10")
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.MaxConcurrentRequests = 1
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetFresh("foo", 5); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 1 {
+		t.Fatalf("%v reads were in flight at once, expected 1", maxInFlight)
+	}
+}
+
+func TestGetIfModifiedSince(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	resp, err := c.Set("foo", "bar", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := resp.Node.ModifiedIndex
+
+	resp, modified, err := c.GetIfModifiedSince("foo", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified || resp != nil {
+		t.Fatalf("GetIfModifiedSince 1 should not return the value: %#v", resp)
+	}
+
+	c.Set("foo", "bar2", 5)
+
+	resp, modified, err = c.GetIfModifiedSince("foo", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(modified && resp.Node.Value == "bar2") {
+		t.Fatalf("GetIfModifiedSince 2 failed: %#v", resp)
+	}
+}
+
+func TestListSubdirs(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("fooDir", true)
+	}()
+
+	c.Set("fooDir/k0", "v0", 5)
+	c.SetDir("fooDir/b", 5)
+	c.Set("fooDir/a/k1", "v1", 5)
+	c.Set("fooDir/k2", "v2", 5)
+
+	subdirs, err := c.ListSubdirs("fooDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(subdirs, []string{"a", "b"}) {
+		t.Fatalf("ListSubdirs failed: %v", subdirs)
+	}
+}
+
+func TestGetWithOptionsStrong(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	// nil options are fine under STRONG_CONSISTENCY
+	if _, err := c.GetWithOptions("foo", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// and the options of the caller are left alone
+	options := Options{"recursive": true}
+	if _, err := c.GetWithOptions("foo", options); err != nil {
+		t.Fatal(err)
+	}
+	c.SetConsistency(WEAK_CONSISTENCY)
+	if _, err := c.GetWithOptions("foo", options); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"consistent=true", "consistent=true&recursive=true", "recursive=true"}
+	if !reflect.DeepEqual(queries, expected) || len(options) != 1 {
+		t.Fatalf("GetWithOptions sent %q, expected %q", queries, expected)
+	}
+}
+
+func TestGetTrimValues(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("trim_foo", true)
+	}()
+
+	c.Set("trim_foo/a", "bar\n", 5)
+	c.Set("trim_foo/b", " baz ", 5)
+
+	result, err := c.Get("trim_foo/a", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Node.Value != "bar\n" {
+		t.Fatalf("Get should not trim by default: %q", result.Node.Value)
+	}
+
+	c.TrimValues = true
+
+	result, err = c.Get("trim_foo/a", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Node.Value != "bar" {
+		t.Fatalf("Get should have trimmed the value: %q", result.Node.Value)
+	}
+
+	result, err = c.Get("trim_foo", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(len(result.Node.Nodes) == 2 && result.Node.Nodes[0].Value == "bar" &&
+		result.Node.Nodes[1].Value == "baz") {
+		t.Fatalf("Get should have trimmed the children: %#v", result.Node.Nodes)
+	}
+
+	raw, err := c.RawGet("trim_foo/a", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw.Body), `"bar\n"`) {
+		t.Fatalf("RawGet should not trim: %s", raw.Body)
+	}
+}
+
+func TestTrimValuesHelpers(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("trim_helpers", true)
+	}()
+
+	c.Set("trim_helpers/quiet", " x ", 5)
+	c.Set("trim_helpers/list", "line1\n", 5)
+	c.TrimValues = true
+	c.QuietSet = true
+
+	// the stored value differs from the trimmed one, so it is written
+	if _, err := c.Set("trim_helpers/quiet", "x", 5); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := c.RawGet("trim_helpers/quiet", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw.Body), `"value":"x"`) {
+		t.Fatalf("QuietSet compared against the trimmed value: %s", raw.Body)
+	}
+
+	if _, err := c.Append("trim_helpers/list", "line2", 5); err != nil {
+		t.Fatal(err)
+	}
+	raw, err = c.RawGet("trim_helpers/list", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw.Body), `"value":"line1\n\nline2"`) {
+		t.Fatalf("Append wrote back the trimmed value: %s", raw.Body)
+	}
+
+	resp, _, err := c.ConsistentSnapshot("trim_helpers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range resp.Node.Nodes {
+		if n.Key == "/trim_helpers/list" && n.Value != "line1\n\nline2" {
+			t.Fatalf("ConsistentSnapshot trimmed %q", n.Value)
+		}
+	}
+}
+
+func TestGetUnsortedOrder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"action":"get","node":{"key":"/fooDir","dir":true,"nodes":[
+			{"key":"/fooDir/k2","value":"v2"},
+			{"key":"/fooDir/k0","value":"v0"},
+			{"key":"/fooDir/sub","dir":true,"nodes":[
+				{"key":"/fooDir/sub/z","value":"z"},
+				{"key":"/fooDir/sub/a","value":"a"}]},
+			{"key":"/fooDir/k1","value":"v1"}]}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	result, err := c.Get("fooDir", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, n := range result.Node.Nodes {
+		keys = append(keys, n.Key)
+		for _, child := range n.Nodes {
+			keys = append(keys, child.Key)
+		}
+	}
+
+	expected := []string{"/fooDir/k2", "/fooDir/k0", "/fooDir/sub",
+		"/fooDir/sub/z", "/fooDir/sub/a", "/fooDir/k1"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Get should keep the server order: %q", keys)
+	}
+}
+
+func TestCurrentIndex(t *testing.T) {
+	hits := 0
+	ts := newIndexServer("bar", 42, &hits)
+	defer ts.Close()
+
+	index, err := NewClient([]string{ts.URL}).CurrentIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(index == 42 && hits == 1) {
+		t.Fatalf("CurrentIndex returned %v after %v requests", index, hits)
+	}
+
+	// A write moves the index of the live machine forward
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	before, err := c.CurrentIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Set("foo", "bar", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := c.CurrentIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(after > before && after == resp.Node.ModifiedIndex) {
+		t.Fatalf("CurrentIndex failed: %v before, %v after the set at %v",
+			before, after, resp.Node.ModifiedIndex)
+	}
+}
+
+func TestCountWhere(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("count_foo", true)
+	}()
+
+	c.Delete("count_foo", true)
+	c.Set("count_foo/a", "down", 5)
+	c.Set("count_foo/b", "up", 5)
+	c.Set("count_foo/dir/c", "down", 5)
+	c.Set("count_foo/dir/sub/d", "down", 5)
+	c.Set("count_foo/dir/sub/e", "up", 5)
+	c.CreateDir("count_foo/empty", 5)
+
+	count, err := c.CountWhere("count_foo", func(n *Node) bool {
+		return n.Kind() == FileNode && n.Value == "down"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("CountWhere counted %v keys, expected 3", count)
+	}
+
+	count, err = c.CountWhere("count_foo", func(n *Node) bool {
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 6 {
+		t.Fatalf("CountWhere counted %v leaves, expected 6", count)
+	}
+
+	if _, err := c.CountWhere("count_missing", func(n *Node) bool { return true }); err == nil {
+		t.Fatal("CountWhere should fail on a missing prefix")
+	}
+}
+
+func TestChangedSince(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("changed_foo", true)
+	}()
+
+	c.Delete("changed_foo", true)
+	c.Set("changed_foo/a", "1", 5)
+	c.Set("changed_foo/dir/b", "2", 5)
+	resp, err := c.Set("changed_foo/c", "3", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := resp.Node.ModifiedIndex
+
+	c.Set("changed_foo/dir/b", "4", 5)
+	c.Set("changed_foo/dir/sub/d", "5", 5)
+
+	nodes, err := c.ChangedSince("changed_foo", since)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, n := range nodes {
+		keys = append(keys, n.Key+"="+n.Value)
+	}
+	expected := []string{"/changed_foo/dir/b=4", "/changed_foo/dir/sub/d=5"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("ChangedSince returned %q, expected %q", keys, expected)
+	}
+
+	nodes, err = c.ChangedSince("changed_foo", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("ChangedSince returned %v nodes, expected all 4", len(nodes))
+	}
+}
+
+func TestGetWithMaxStaleness(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	// The leader is at raft index 100
+	var leaderHeads, leaderGets, followerHits int
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			leaderHeads++
+		} else {
+			leaderGets++
+		}
+		w.Header().Set("X-Etcd-Index", "10")
+		w.Header().Set("X-Raft-Index", "100")
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"fresh"}}`))
+	}))
+	defer leader.Close()
+
+	// The follower lags behind other writers
+	followerIndex := "50"
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		followerHits++
+		w.Header().Set("X-Etcd-Index", "5")
+		w.Header().Set("X-Raft-Index", followerIndex)
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"stale"}}`))
+	}))
+	defer follower.Close()
+
+	c := NewClient([]string{leader.URL, follower.URL})
+
+	resp, err := c.GetWithMaxStaleness("foo", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "fresh" && followerHits == 1 && leaderHeads == 1 && leaderGets == 1) {
+		t.Fatalf("the leader should have been read: %v, %v/%v/%v hits",
+			resp.Node.Value, followerHits, leaderHeads, leaderGets)
+	}
+
+	// Once it caught up, the follower is read, and the index of the leader
+	// is trusted for maxAge
+	followerIndex = "100"
+	now = now.Add(5 * time.Second)
+	resp, err = c.GetWithMaxStaleness("foo", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "stale" && followerHits == 2 && leaderHeads == 1 && leaderGets == 1) {
+		t.Fatalf("the follower should have been read: %v, %v/%v/%v hits",
+			resp.Node.Value, followerHits, leaderHeads, leaderGets)
+	}
+
+	// Past maxAge, the leader is asked again
+	now = now.Add(10 * time.Second)
+	if _, err = c.GetWithMaxStaleness("foo", 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if leaderHeads != 2 {
+		t.Fatalf("the leader was asked for its index %v times, expected 2", leaderHeads)
+	}
+}
+
+func TestGetResolved(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("resolved_foo", true)
+	}()
+
+	c.Set("resolved_foo/value", "bar", 5)
+	c.Set("resolved_foo/ref1", ReferenceMarker+"/resolved_foo/value", 5)
+	c.Set("resolved_foo/ref2", ReferenceMarker+"/resolved_foo/ref1", 5)
+
+	resp, err := c.GetResolved("resolved_foo/ref2", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Key == "/resolved_foo/value" && resp.Node.Value == "bar") {
+		t.Fatalf("GetResolved returned %v=%v, expected /resolved_foo/value=bar",
+			resp.Node.Key, resp.Node.Value)
+	}
+
+	// Two references are one too many for a depth of one
+	if _, err := c.GetResolved("resolved_foo/ref2", 1); err == nil {
+		t.Fatal("GetResolved should fail beyond maxDepth")
+	}
+
+	c.Set("resolved_foo/a", ReferenceMarker+"/resolved_foo/b", 5)
+	c.Set("resolved_foo/b", ReferenceMarker+"/resolved_foo/a", 5)
+
+	_, err = c.GetResolved("resolved_foo/a", 10)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("GetResolved of a cycle returned %v, expected a cycle error", err)
+	}
+}
+
+func TestListWithTTL(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("ttl_foo", true)
+	}()
+
+	c.Delete("ttl_foo", true)
+	c.Set("ttl_foo/a", "1", 100)
+	c.Set("ttl_foo/b", "2", 0)
+	c.Set("ttl_foo/dir/c", "3", 200)
+	c.SetDir("ttl_foo/empty", 0)
+
+	ttls, err := c.ListWithTTL("ttl_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the TTLs may already have ticked down
+	if !(len(ttls) == 4 && ttls["/ttl_foo/b"] == -1 && ttls["/ttl_foo/empty"] == -1 &&
+		ttls["/ttl_foo/a"] > 95 && ttls["/ttl_foo/a"] <= 100 &&
+		ttls["/ttl_foo/dir/c"] > 195 && ttls["/ttl_foo/dir/c"] <= 200) {
+		t.Fatalf("ListWithTTL returned %v", ttls)
+	}
+}
+
+func TestListWithTTLUncached(t *testing.T) {
+	ttl := 10
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"action":"get","node":{"key":"/ttl_foo","dir":true,"nodes":[{"key":"/ttl_foo/a","value":"1","expiration":"2030-01-01T00:00:00Z","ttl":%v}]}}`, ttl)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.SetConsistency(WEAK_CONSISTENCY)
+	c.EnableCache(time.Minute)
+
+	if _, err := c.ListWithTTL("ttl_foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the TTL ticks down, which the cache would hide
+	ttl = 3
+	ttls, err := c.ListWithTTL("ttl_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttls["/ttl_foo/a"] != 3 {
+		t.Fatalf("ListWithTTL returned %v, expected the current TTL", ttls)
+	}
+}
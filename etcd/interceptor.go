@@ -0,0 +1,52 @@
+package etcd
+
+import "net/http"
+
+// Interceptor wraps the sending of a HTTP request by the client, for
+// concerns such as authentication, tracing or metrics. It may inspect and
+// modify req, and calls next to send it, through the interceptors added
+// after it, or skips next to answer the request itself.
+type Interceptor func(req *http.Request, next func() (*http.Response, error)) (*http.Response, error)
+
+// Use adds an interceptor around every attempt to send a request,
+// including those of SyncCluster, ClusterHealth, GetVersion and the
+// statistics of members. The interceptors run in the order they were
+// added, the first one being the outermost. Use must not be called while
+// requests are in flight.
+func (c *Client) Use(interceptor Interceptor) {
+	c.interceptors = append(c.interceptors, interceptor)
+}
+
+// do sends req through the interceptors.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	return c.doWith(c.httpClient, req)
+}
+
+// doWith sends req with the given HTTP client, e.g. one bounded by
+// DiscoveryTimeout, through the interceptors.
+func (c *Client) doWith(client *http.Client, req *http.Request) (*http.Response, error) {
+	return c.intercept(client, 0, req)
+}
+
+// getURL issues a GET of the given URL of the given machine with the
+// given HTTP client, through the interceptors and with the credentials
+// of the machine, like the requests sent by SendRequest.
+func (c *Client) getURL(client *http.Client, machine, url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	setCredentials(req, machine)
+
+	return c.doWith(client, req)
+}
+
+func (c *Client) intercept(client *http.Client, i int, req *http.Request) (*http.Response, error) {
+	if i == len(c.interceptors) {
+		return client.Do(req)
+	}
+
+	return c.interceptors[i](req, func() (*http.Response, error) {
+		return c.intercept(client, i+1, req)
+	})
+}
@@ -0,0 +1,79 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestUse(t *testing.T) {
+	var calls []string
+
+	// the interceptors seen by each path
+	seen := make(map[string]string)
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen[r.URL.Path] = r.Header.Get("X-Interceptor")
+		switch r.URL.Path {
+		case "/v2/machines":
+			fmt.Fprint(w, ts.URL)
+		case "/version":
+			fmt.Fprint(w, `{"etcdserver":"2.3.8","etcdcluster":"2.3.0"}`)
+		case "/v2/members":
+			fmt.Fprintf(w, `{"members":[{"id":"a","name":"a","clientURLs":["%s"]}]}`, ts.URL)
+		case "/health":
+			fmt.Fprint(w, `{"health":"true"}`)
+		default:
+			calls = append(calls, "request "+r.Header.Get("X-Interceptor"))
+			w.Header().Set("X-Etcd-Index", "1")
+			fmt.Fprint(w, `{"action":"get","node":{"key":"/foo","value":"bar"}}`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	interceptor := func(name string) Interceptor {
+		return func(req *http.Request, next func() (*http.Response, error)) (*http.Response, error) {
+			calls = append(calls, name+" before")
+			req.Header.Set("X-Interceptor", req.Header.Get("X-Interceptor")+name)
+			resp, err := next()
+			calls = append(calls, name+" after")
+			return resp, err
+		}
+	}
+	c.Use(interceptor("a"))
+	c.Use(interceptor("b"))
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "bar" {
+		t.Fatalf("Get returned %v, expected bar", resp.Node.Value)
+	}
+
+	expected := []string{"a before", "b before", "request ab", "b after", "a after"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("the interceptors ran as %q, expected %q", calls, expected)
+	}
+
+	// the requests sent outside of SendRequest go through them as well
+	if !c.SyncCluster() {
+		t.Fatal("SyncCluster failed")
+	}
+	if _, err := c.GetVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if _, healthy, err := c.ClusterHealth(); err != nil || healthy != 1 {
+		t.Fatalf("ClusterHealth failed: %v healthy, %v", healthy, err)
+	}
+	for _, p := range []string{"/v2/machines", "/version", "/v2/members", "/health"} {
+		if seen[p] != "ab" {
+			t.Errorf("%v was sent through the interceptors %q, expected ab", p, seen[p])
+		}
+	}
+}
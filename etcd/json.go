@@ -0,0 +1,35 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SetJSON sets the given key to the JSON encoding of v.
+func (c *Client) SetJSON(key string, v interface{}, ttl uint64) (*Response, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Set(key, string(b), ttl)
+}
+
+// GetJSON gets the value of the given key and decodes it as JSON into
+// out. If the key does not exist, the *EtcdError with ErrCodeKeyNotFound
+// is returned; if the value is not valid JSON, the error says so.
+func (c *Client) GetJSON(key string, out interface{}) error {
+	resp, err := c.read(key, false, false)
+	if err != nil {
+		return err
+	}
+
+	if resp.Node.Dir {
+		return fmt.Errorf("%v is a directory, not a JSON value", resp.Node.Key)
+	}
+
+	if err := json.Unmarshal([]byte(resp.Node.Value), out); err != nil {
+		return fmt.Errorf("The value of %v is not valid JSON: %v", resp.Node.Key, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package etcd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetJSON(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+		c.Delete("fooDir", true)
+	}()
+
+	type config struct {
+		Name    string   `json:"name"`
+		Enabled bool     `json:"enabled"`
+		Hosts   []string `json:"hosts"`
+	}
+
+	expected := config{Name: "foo", Enabled: true, Hosts: []string{"a", "b"}}
+	if _, err := c.SetJSON("foo", expected, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual config
+	if err := c.GetJSON("foo", &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("GetJSON failed: %#v", actual)
+	}
+
+	c.Delete("foo", true)
+	err := c.GetJSON("foo", &actual)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+		t.Fatalf("GetJSON on a missing key should fail with ErrCodeKeyNotFound: %v", err)
+	}
+
+	c.Set("foo", "{not json", 5)
+	if err := c.GetJSON("foo", &actual); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Fatalf("GetJSON should fail on invalid JSON: %v", err)
+	}
+
+	c.CreateDir("fooDir", 5)
+	if err := c.GetJSON("fooDir", &actual); err == nil {
+		t.Fatal("GetJSON should fail on a directory")
+	}
+}
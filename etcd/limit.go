@@ -0,0 +1,48 @@
+package etcd
+
+import (
+	"strings"
+	"sync"
+)
+
+// requestLimiter bounds the number of requests in flight, see
+// Client.MaxConcurrentRequests.
+type requestLimiter struct {
+	sync.Mutex
+	slots chan struct{}
+}
+
+func newRequestLimiter() *requestLimiter {
+	return &requestLimiter{}
+}
+
+// acquire blocks until fewer than max requests are in flight, or until
+// cancel is closed, in which case it returns nil. The returned channel
+// must be passed to release once the request is done.
+func (l *requestLimiter) acquire(max int, cancel <-chan bool) chan struct{} {
+	l.Lock()
+	if l.slots == nil || cap(l.slots) != max {
+		// requests in flight release their slots to the old channel
+		l.slots = make(chan struct{}, max)
+	}
+	slots := l.slots
+	l.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return slots
+	case <-cancel:
+		return nil
+	}
+}
+
+// release frees a slot taken by acquire.
+func (l *requestLimiter) release(slots chan struct{}) {
+	<-slots
+}
+
+// isWaitRequest reports whether the request is a watch, which may stay
+// in flight for a long time.
+func isWaitRequest(rr *RawRequest) bool {
+	return strings.Contains(rr.RelativePath, "wait=true")
+}
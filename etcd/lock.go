@@ -0,0 +1,70 @@
+package etcd
+
+import "fmt"
+
+// AcquireLock takes the lock held by the given key for holder, by
+// creating the key with holder as its value and the given ttl. It
+// reports whether the lock was acquired, with the ModifiedIndex of the
+// key, which serves as a fencing token: it grows with every acquisition,
+// so resources guarded by the lock can reject a stale holder. If another
+// holder has the lock, false is returned without an error.
+//
+// The lock is lost once the ttl runs out, unless it is renewed with
+// RenewLock.
+func (c *Client) AcquireLock(key, holder string, ttl uint64) (bool, uint64, error) {
+	resp, err := c.Create(key, holder, ttl)
+	if err != nil {
+		if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyAlreadyExists {
+			return false, 0, nil
+		}
+		return false, 0, err
+	}
+
+	// the lock may be held nonetheless, until its TTL runs out
+	if resp.Node == nil {
+		return false, 0, ErrNoNode
+	}
+	return true, resp.Node.ModifiedIndex, nil
+}
+
+// RenewLock resets the ttl of the lock held by the given key, provided
+// holder still has it. Otherwise an *EtcdError with ErrCodeCompareFailed,
+// or ErrCodeKeyNotFound if the lock expired, is returned. Watchers of the
+// key are not woken up.
+func (c *Client) RenewLock(key, holder string, ttl uint64) error {
+	ops := Options{
+		"refresh":   true,
+		"prevValue": holder,
+	}
+
+	raw, err := c.put(key, "", ttl, ops)
+	if err != nil {
+		return err
+	}
+
+	_, err = raw.Unmarshal()
+	return err
+}
+
+// ReleaseLock deletes the key holding the lock, provided holder still has
+// it, so that a holder whose lock expired cannot release the lock of the
+// next one. Otherwise an *EtcdError with ErrCodeCompareFailed, or
+// ErrCodeKeyNotFound if the lock expired, is returned.
+func (c *Client) ReleaseLock(key, holder string) error {
+	_, err := c.CompareAndDelete(key, holder, 0)
+	return err
+}
+
+// DeleteIfIndex deletes the given key provided its ModifiedIndex is still
+// prevIndex, e.g. the fencing token returned by AcquireLock, so that a
+// holder only releases a lease nobody took over since. Renewing the key
+// moves its ModifiedIndex too. Otherwise an *EtcdError with
+// ErrCodeCompareFailed, or ErrCodeKeyNotFound if the key is gone, is
+// returned.
+func (c *Client) DeleteIfIndex(key string, prevIndex uint64) (*Response, error) {
+	if prevIndex == 0 {
+		return nil, fmt.Errorf("You must give a prevIndex.")
+	}
+
+	return c.CompareAndDelete(key, "", prevIndex)
+}
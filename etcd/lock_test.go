@@ -0,0 +1,149 @@
+package etcd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAcquireLock(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("lock_foo", true)
+	}()
+
+	c.Delete("lock_foo", true)
+
+	acquired, fence, err := c.AcquireLock("lock_foo", "a", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(acquired && fence > 0) {
+		t.Fatalf("a should have acquired the lock: %v %v", acquired, fence)
+	}
+
+	// b has to wait for a
+	acquired, _, err = c.AcquireLock("lock_foo", "b", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acquired {
+		t.Fatal("b should not acquire the lock held by a")
+	}
+
+	if err := c.RenewLock("lock_foo", "a", 10); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get("lock_foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "a" && resp.Node.TTL > 5) {
+		t.Fatalf("RenewLock failed: %#v", resp.Node)
+	}
+
+	// Only the holder may renew and release the lock
+	err = c.RenewLock("lock_foo", "b", 10)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeCompareFailed {
+		t.Fatalf("b should not renew the lock of a: %v", err)
+	}
+	err = c.ReleaseLock("lock_foo", "b")
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeCompareFailed {
+		t.Fatalf("b should not release the lock of a: %v", err)
+	}
+
+	if err := c.ReleaseLock("lock_foo", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	acquired, nextFence, err := c.AcquireLock("lock_foo", "b", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(acquired && nextFence > fence) {
+		t.Fatalf("b should have acquired the released lock: %v %v", acquired, nextFence)
+	}
+
+	// a lost the lock, so it cannot release it anymore
+	err = c.ReleaseLock("lock_foo", "a")
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeCompareFailed {
+		t.Fatalf("a should not release the lock of b: %v", err)
+	}
+
+	c.Delete("lock_foo", true)
+	err = c.RenewLock("lock_foo", "b", 10)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+		t.Fatalf("renewing a lock that is gone should fail: %v", err)
+	}
+}
+
+func TestAcquireLockContention(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("lock_foo", true)
+	}()
+
+	c.Delete("lock_foo", true)
+
+	results := make(chan bool)
+	for i := 0; i < 5; i++ {
+		go func(holder string) {
+			acquired, _, err := NewClient(nil).AcquireLock("lock_foo", holder, 5)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- acquired
+		}(fmt.Sprint("holder", i))
+	}
+
+	winners := 0
+	for i := 0; i < 5; i++ {
+		if <-results {
+			winners++
+		}
+	}
+	if winners != 1 {
+		t.Fatalf("exactly one holder should get the lock, got %v", winners)
+	}
+}
+
+func TestDeleteIfIndex(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("lock_foo", true)
+	}()
+
+	c.Delete("lock_foo", true)
+
+	_, staleFence, err := c.AcquireLock("lock_foo", "a", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lease of a expires and b takes it over
+	c.Delete("lock_foo", false)
+	_, fence, err := c.AcquireLock("lock_foo", "b", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.DeleteIfIndex("lock_foo", staleFence)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeCompareFailed {
+		t.Fatalf("DeleteIfIndex with a stale index returned %v, expected a compare failure", err)
+	}
+	if _, err := c.Get("lock_foo", false, false); err != nil {
+		t.Fatalf("the lease of b should be kept: %v", err)
+	}
+
+	resp, err := c.DeleteIfIndex("lock_foo", fence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Action == "compareAndDelete" && resp.PrevNode.Value == "b") {
+		t.Fatalf("DeleteIfIndex did not delete the lease of b: %#v", resp)
+	}
+
+	_, err = c.DeleteIfIndex("lock_foo", fence)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+		t.Fatalf("DeleteIfIndex of a deleted key returned %v, expected a not found error", err)
+	}
+}
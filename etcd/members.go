@@ -0,0 +1,201 @@
+package etcd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Member is a member of the cluster, as served under /v2/members.
+type Member struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+}
+
+// GetMembers returns the members of the cluster.
+func (c *Client) GetMembers() ([]Member, error) {
+	return c.getMembers(nil)
+}
+
+// getMembers is GetMembers, cancelled when cancel is closed.
+func (c *Client) getMembers(cancel <-chan bool) ([]Member, error) {
+	logger.Debugf("members [%s]", c.cluster.Leader)
+
+	req := NewRawRequest("GET", "members", nil, cancel)
+	raw, err := c.SendRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if raw.StatusCode != http.StatusOK {
+		return nil, handleError(raw.Body)
+	}
+
+	var collection struct {
+		Members []Member `json:"members"`
+	}
+	if err := json.Unmarshal(raw.Body, &collection); err != nil {
+		return nil, err
+	}
+
+	return collection.Members, nil
+}
+
+// memberURLs returns the URLs to send the requests for the given member
+// to, see Client.MemberURLSelector.
+func (c *Client) memberURLs(m Member) []string {
+	if c.MemberURLSelector != nil {
+		return c.MemberURLSelector(m)
+	}
+	return m.ClientURLs
+}
+
+// updateFromMembers sets the machines to the URLs of the members listed
+// in the given /v2/members body.
+func (c *Client) updateFromMembers(b []byte) error {
+	var collection struct {
+		Members []Member `json:"members"`
+	}
+	if err := json.Unmarshal(b, &collection); err != nil {
+		return err
+	}
+
+	var machines []string
+	for _, member := range collection.Members {
+		machines = append(machines, c.memberURLs(member)...)
+	}
+	if len(machines) == 0 {
+		return errors.New("The cluster has no member URLs")
+	}
+
+	c.cluster.Machines = machines
+	return nil
+}
+
+// ClusterHealth returns the number of members of the cluster and how
+// many of them are healthy. The /health endpoint of every member is
+// checked concurrently; a member with several client URLs is healthy if
+// any of them reports so.
+//
+// The check is bounded by Client.DiscoveryTimeout. Members which do not
+// answer in time count as unhealthy.
+func (c *Client) ClusterHealth() (total int, healthy int, err error) {
+	d := c.startDiscovery()
+	defer d.stop()
+
+	members, err := c.getMembers(d.cancel)
+	if err != nil {
+		return 0, 0, d.err(err)
+	}
+
+	client := d.httpClient(c.httpClient)
+
+	var wg sync.WaitGroup
+	results := make([]bool, len(members))
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, member Member) {
+			defer wg.Done()
+			results[i] = c.isHealthy(client, member)
+		}(i, member)
+	}
+	wg.Wait()
+
+	for _, ok := range results {
+		if ok {
+			healthy++
+		}
+	}
+	return len(members), healthy, nil
+}
+
+// isHealthy checks the /health endpoint of the given member with the
+// given HTTP client, trying each of its URLs in turn.
+func (c *Client) isHealthy(client *http.Client, member Member) bool {
+	for _, clientURL := range c.memberURLs(member) {
+		resp, err := c.getURL(client, clientURL, c.createHttpPath(clientURL, "health"))
+		if err != nil {
+			logger.Debugf("health.check %s failed: %v", clientURL, err)
+			continue
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			continue
+		}
+
+		var health struct {
+			Health string `json:"health"`
+		}
+		if err := json.Unmarshal(b, &health); err == nil && health.Health == "true" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReconcileMembership compares the machines the client knows of with the
+// members of the cluster. It returns the URLs of members the client does
+// not know of, see MemberURLSelector, and the machines that are not members
+// anymore. If apply is set, the machine list of the client is updated
+// accordingly, as if by SyncCluster.
+func (c *Client) ReconcileMembership(apply bool) (added, removed []string, err error) {
+	members, err := c.GetMembers()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, machine := range c.cluster.Machines {
+		known[strings.TrimSuffix(machine, "/")] = true
+	}
+
+	current := make(map[string]bool)
+	for _, member := range members {
+		isKnown := false
+		urls := c.memberURLs(member)
+		for _, clientURL := range urls {
+			clientURL = strings.TrimSuffix(clientURL, "/")
+			current[clientURL] = true
+			isKnown = isKnown || known[clientURL]
+		}
+		if !isKnown {
+			added = append(added, urls...)
+		}
+	}
+
+	var kept []string
+	for _, machine := range c.cluster.Machines {
+		if current[strings.TrimSuffix(machine, "/")] {
+			kept = append(kept, machine)
+		} else {
+			removed = append(removed, machine)
+		}
+	}
+
+	if apply && (len(added) > 0 || len(removed) > 0) {
+		machines := append(kept, added...)
+		if len(machines) == 0 {
+			return added, removed, errors.New("The cluster has no client URLs")
+		}
+
+		leader := c.cluster.Leader
+		c.cluster.Machines = machines
+		if !current[strings.TrimSuffix(leader, "/")] {
+			c.cluster.switchLeader(0)
+			c.leaderProbed = false
+		}
+
+		logger.Debug("reconcile.machines ", c.cluster.Machines)
+		c.saveConfig()
+	}
+
+	return added, removed, nil
+}
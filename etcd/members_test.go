@@ -0,0 +1,121 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClusterHealth(t *testing.T) {
+	healthy := newStatsServer(http.StatusOK, `{"health":"true"}`)
+	defer healthy.Close()
+
+	unhealthy := newStatsServer(http.StatusServiceUnavailable, `{"health":"false"}`)
+	defer unhealthy.Close()
+
+	// The second member is only reachable through its second client URL
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"members":[
+			{"id":"a","name":"a","clientURLs":["%s"]},
+			{"id":"b","name":"b","clientURLs":["http://127.0.0.1:1","%s"]},
+			{"id":"c","name":"c","clientURLs":["%s"]}]}`,
+			healthy.URL, healthy.URL, unhealthy.URL)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	total, ok, err := c.ClusterHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(total == 3 && ok == 2) {
+		t.Fatalf("ClusterHealth failed: %v members, %v healthy", total, ok)
+	}
+}
+
+func TestClusterHealthTimeout(t *testing.T) {
+	healthy := newStatsServer(http.StatusOK, `{"health":"true"}`)
+	defer healthy.Close()
+
+	slow := newSlowServers(2, 500*time.Millisecond)
+	for _, ts := range slow {
+		defer ts.Close()
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"members":[
+			{"id":"a","name":"a","clientURLs":["%s"]},
+			{"id":"b","name":"b","clientURLs":["%s"]},
+			{"id":"c","name":"c","clientURLs":["%s"]}]}`,
+			healthy.URL, slow[0].URL, slow[1].URL)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.DiscoveryTimeout = 100 * time.Millisecond
+
+	// The slow members count as unhealthy
+	start := time.Now()
+	total, ok, err := c.ClusterHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(total == 3 && ok == 1) {
+		t.Fatalf("ClusterHealth failed: %v members, %v healthy", total, ok)
+	}
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("ClusterHealth took %v, expected about %v", elapsed, c.DiscoveryTimeout)
+	}
+}
+
+func TestReconcileMembership(t *testing.T) {
+	// The stub lists itself with a trailing slash
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"members":[
+			{"id":"a","name":"a","clientURLs":["http://%s/"]},
+			{"id":"b","name":"b","clientURLs":["http://b:4001","http://b:2379"]},
+			{"id":"c","name":"c","clientURLs":["http://c:4001"]}]}`, r.Host)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL, "http://b:2379", "http://d:4001"})
+	machines := append([]string(nil), c.GetCluster()...)
+
+	added, removed, err := c.ReconcileMembership(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(added, []string{"http://c:4001"}) {
+		t.Fatalf("unexpected added machines: %q", added)
+	}
+	if !reflect.DeepEqual(removed, []string{"http://d:4001"}) {
+		t.Fatalf("unexpected removed machines: %q", removed)
+	}
+	if len(c.GetCluster()) != 3 {
+		t.Fatalf("the machines should not change: %q", c.GetCluster())
+	}
+
+	if _, _, err := c.ReconcileMembership(true); err != nil {
+		t.Fatal(err)
+	}
+	// The kept machines stay in their order, which is shuffled
+	var expected []string
+	for _, machine := range machines {
+		if machine != "http://d:4001" {
+			expected = append(expected, machine)
+		}
+	}
+	expected = append(expected, "http://c:4001")
+	if !reflect.DeepEqual(c.GetCluster(), expected) {
+		t.Fatalf("ReconcileMembership did not apply the changes: %q", c.GetCluster())
+	}
+
+	added, removed, err = c.ReconcileMembership(false)
+	if !(err == nil && len(added) == 0 && len(removed) == 0) {
+		t.Fatalf("the machines should match the members: %q %q %v", added, removed, err)
+	}
+}
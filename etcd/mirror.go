@@ -0,0 +1,152 @@
+package etcd
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MirrorMap is an in-memory copy of the keys under a prefix, kept up to
+// date by Mirror.
+type MirrorMap struct {
+	sync.RWMutex
+	values map[string]string
+	// index is the etcd index the copy is up to date with
+	index uint64
+}
+
+// Get returns the value of the given key, and whether it exists.
+func (m *MirrorMap) Get(key string) (string, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	value, ok := m.values[path.Join("/", key)]
+	return value, ok
+}
+
+// Snapshot returns a copy of all the keys, by their full path, with
+// their values.
+func (m *MirrorMap) Snapshot() map[string]string {
+	m.RLock()
+	defer m.RUnlock()
+
+	values := make(map[string]string, len(m.values))
+	for k, v := range m.values {
+		values[k] = v
+	}
+	return values
+}
+
+// apply updates the copy according to a change received by a watch.
+func (m *MirrorMap) apply(resp *Response) {
+	m.Lock()
+	defer m.Unlock()
+
+	n := resp.Node
+	if isRemovalAction(resp.Action) {
+		delete(m.values, n.Key)
+		for k := range m.values {
+			if strings.HasPrefix(k, n.Key+"/") {
+				delete(m.values, k)
+			}
+		}
+	} else if !n.Dir {
+		m.values[n.Key] = n.Value
+	}
+	m.index = n.ModifiedIndex
+}
+
+// reset replaces the copy with the given tree, read at the given index.
+func (m *MirrorMap) reset(root *Node, index uint64) {
+	values := make(map[string]string)
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if !n.Dir {
+			values[n.Key] = n.Value
+		}
+		for _, child := range n.Nodes {
+			walk(child)
+		}
+	}
+	if root != nil {
+		walk(root)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.values = values
+	m.index = index
+}
+
+// Mirror reads the tree under the given prefix into a MirrorMap, and
+// keeps watching the prefix in the background to apply every change to
+// it, until the stop channel is closed. If the watch falls too far
+// behind for etcd to replay the changes, or fails altogether, the tree
+// is read anew.
+//
+// Only the first read is reported as an error; later failures are
+// retried, waiting as described by Client.RetryBackoff.
+func (c *Client) Mirror(prefix string, stop chan bool) (*MirrorMap, error) {
+	m := new(MirrorMap)
+	if err := c.resetMirror(m, prefix); err != nil {
+		return nil, err
+	}
+
+	go c.updateMirror(m, prefix, stop)
+	return m, nil
+}
+
+// resetMirror reads the tree under the given prefix into m.
+func (c *Client) resetMirror(m *MirrorMap, prefix string) error {
+	resp, err := c.read(prefix, false, true)
+	if err != nil {
+		etcdErr, ok := err.(*EtcdError)
+		if !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+			return err
+		}
+		m.reset(nil, etcdErr.Index)
+		return nil
+	}
+
+	m.reset(resp.Node, resp.EtcdIndex)
+	return nil
+}
+
+// updateMirror watches the given prefix and applies the changes to m.
+func (c *Client) updateMirror(m *MirrorMap, prefix string, stop chan bool) {
+	backoff := c.newBackoff()
+	for {
+		m.RLock()
+		index := m.index
+		m.RUnlock()
+
+		_, err := c.watchLoop(prefix, index+1, true, stop,
+			func(resp *Response, raw *RawResponse) {
+				m.apply(resp)
+			})
+		if err == ErrWatchStoppedByUser {
+			return
+		}
+
+		if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeEventIndexCleared {
+			logger.Debugf("mirror.resync of %s: %v", prefix, err)
+		} else {
+			logger.Warningf("mirror.watch of %s failed: %v", prefix, err)
+		}
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(backoff.next()):
+			}
+
+			if err := c.resetMirror(m, prefix); err == nil {
+				break
+			}
+			logger.Warningf("mirror.read of %s failed: %v", prefix, err)
+		}
+		backoff = c.newBackoff()
+	}
+}
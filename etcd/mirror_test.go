@@ -0,0 +1,107 @@
+package etcd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// waitForMirror waits for the mirror to hold the expected keys.
+func waitForMirror(t *testing.T, m *MirrorMap, expected map[string]string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		actual := m.Snapshot()
+		if reflect.DeepEqual(actual, expected) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the mirror holds %v, expected %v", actual, expected)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMirror(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("mirror_foo", true)
+	}()
+
+	c.Delete("mirror_foo", true)
+	c.Set("mirror_foo/a", "1", 100)
+	c.Set("mirror_foo/dir/b", "2", 100)
+
+	stop := make(chan bool)
+	defer close(stop)
+
+	m, err := c.Mirror("mirror_foo", stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, ok := m.Get("mirror_foo/dir/b"); !(ok && value == "2") {
+		t.Fatalf("the mirror should hold the initial keys: %v", m.Snapshot())
+	}
+
+	c.Set("mirror_foo/a", "10", 100)
+	c.Create("mirror_foo/dir/c", "3", 100)
+	c.Set("mirror_foo/d", "4", 1)
+	waitForMirror(t, m, map[string]string{
+		"/mirror_foo/a":     "10",
+		"/mirror_foo/dir/b": "2",
+		"/mirror_foo/dir/c": "3",
+		"/mirror_foo/d":     "4",
+	})
+
+	c.Delete("mirror_foo/a", false)
+	c.Delete("mirror_foo/dir", true)
+	waitForMirror(t, m, map[string]string{
+		"/mirror_foo/d": "4",
+	})
+
+	// d expires
+	waitForMirror(t, m, map[string]string{})
+}
+
+func TestMirrorResync(t *testing.T) {
+	done := make(chan bool)
+	reads, watches := 0, 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("wait") != "true" {
+			reads++
+			w.Header().Set("X-Etcd-Index", "10")
+			if reads == 1 {
+				w.Write([]byte(`{"action":"get","node":{"key":"/foo","dir":true,"nodes":[
+					{"key":"/foo/a","value":"1"}]}}`))
+				return
+			}
+			w.Write([]byte(`{"action":"get","node":{"key":"/foo","dir":true,"nodes":[
+				{"key":"/foo/a","value":"2"}]}}`))
+			return
+		}
+
+		// The first watch is too far behind, the next ones see no change
+		watches++
+		if watches == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errorCode":401,"message":"The event in requested index is outdated and cleared","index":100}`))
+			return
+		}
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	stop := make(chan bool)
+	defer close(stop)
+
+	m, err := NewClient([]string{ts.URL}).Mirror("foo", stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitForMirror(t, m, map[string]string{"/foo/a": "2"})
+}
@@ -19,6 +19,7 @@ var (
 	VALID_GET_OPTIONS = validOptions{
 		"recursive":  reflect.Bool,
 		"consistent": reflect.Bool,
+		"quorum":     reflect.Bool,
 		"sorted":     reflect.Bool,
 		"wait":       reflect.Bool,
 		"waitIndex":  reflect.Uint64,
@@ -29,6 +30,7 @@ var (
 		"prevIndex": reflect.Uint64,
 		"prevExist": reflect.Bool,
 		"dir":       reflect.Bool,
+		"refresh":   reflect.Bool,
 	}
 
 	VALID_POST_OPTIONS = validOptions{}
@@ -41,7 +43,9 @@ var (
 	}
 )
 
-// Convert options to a string of HTML parameters
+// Convert options to a string of HTML parameters.
+// The option values are percent-encoded, so they may contain
+// reserved characters such as "&", "=" or "+".
 func (ops Options) toParameters(validOps validOptions) (string, error) {
 	p := "?"
 	values := url.Values{}
@@ -70,3 +74,167 @@ func (ops Options) toParameters(validOps validOptions) (string, error) {
 	p += values.Encode()
 	return p, nil
 }
+
+// GetOptionsBuilder builds the Options of a GET, see NewGetOptions.
+type GetOptionsBuilder struct {
+	ops Options
+}
+
+// NewGetOptions returns a builder for the Options of a GET, to be used as
+//
+//	ops, err := NewGetOptions().Recursive(true).Sorted(true).Build()
+//	resp, err := c.GetWithOptions("foo", ops)
+func NewGetOptions() *GetOptionsBuilder {
+	return &GetOptionsBuilder{ops: Options{}}
+}
+
+func (b *GetOptionsBuilder) Recursive(recursive bool) *GetOptionsBuilder {
+	b.ops["recursive"] = recursive
+	return b
+}
+
+func (b *GetOptionsBuilder) Sorted(sorted bool) *GetOptionsBuilder {
+	b.ops["sorted"] = sorted
+	return b
+}
+
+func (b *GetOptionsBuilder) Wait(wait bool) *GetOptionsBuilder {
+	b.ops["wait"] = wait
+	return b
+}
+
+// WaitIndex implies Wait(true).
+func (b *GetOptionsBuilder) WaitIndex(waitIndex uint64) *GetOptionsBuilder {
+	b.ops["waitIndex"] = waitIndex
+	return b
+}
+
+// Build validates the options and returns them.
+func (b *GetOptionsBuilder) Build() (Options, error) {
+	if _, ok := b.ops["waitIndex"]; ok {
+		if wait, ok := b.ops["wait"]; ok && !wait.(bool) {
+			return nil, fmt.Errorf("Option waitIndex requires wait")
+		}
+		b.ops["wait"] = true
+	}
+
+	return b.ops.copy(), nil
+}
+
+// PutOptionsBuilder builds the Options of a PUT, see NewPutOptions.
+type PutOptionsBuilder struct {
+	ops Options
+}
+
+// NewPutOptions returns a builder for the Options of a PUT, to be used
+// with PutWithOptions.
+func NewPutOptions() *PutOptionsBuilder {
+	return &PutOptionsBuilder{ops: Options{}}
+}
+
+func (b *PutOptionsBuilder) PrevValue(prevValue string) *PutOptionsBuilder {
+	b.ops["prevValue"] = prevValue
+	return b
+}
+
+func (b *PutOptionsBuilder) PrevIndex(prevIndex uint64) *PutOptionsBuilder {
+	b.ops["prevIndex"] = prevIndex
+	return b
+}
+
+func (b *PutOptionsBuilder) PrevExist(prevExist bool) *PutOptionsBuilder {
+	b.ops["prevExist"] = prevExist
+	return b
+}
+
+func (b *PutOptionsBuilder) Dir(dir bool) *PutOptionsBuilder {
+	b.ops["dir"] = dir
+	return b
+}
+
+func (b *PutOptionsBuilder) Refresh(refresh bool) *PutOptionsBuilder {
+	b.ops["refresh"] = refresh
+	return b
+}
+
+// Build validates the options and returns them.
+func (b *PutOptionsBuilder) Build() (Options, error) {
+	_, hasPrevValue := b.ops["prevValue"]
+	_, hasPrevIndex := b.ops["prevIndex"]
+
+	if prevExist, ok := b.ops["prevExist"]; ok && !prevExist.(bool) &&
+		(hasPrevValue || hasPrevIndex) {
+		return nil, fmt.Errorf("Options prevValue and prevIndex require the key to exist")
+	}
+
+	if dir, ok := b.ops["dir"]; ok && dir.(bool) && hasPrevValue {
+		return nil, fmt.Errorf("Option prevValue cannot be used with dir")
+	}
+
+	if refresh, ok := b.ops["refresh"]; ok && refresh.(bool) {
+		if prevExist, ok := b.ops["prevExist"]; ok && !prevExist.(bool) {
+			return nil, fmt.Errorf("Option refresh requires the key to exist")
+		}
+	}
+
+	return b.ops.copy(), nil
+}
+
+// DeleteOptionsBuilder builds the Options of a DELETE,
+// see NewDeleteOptions.
+type DeleteOptionsBuilder struct {
+	ops Options
+}
+
+// NewDeleteOptions returns a builder for the Options of a DELETE,
+// to be used with DeleteWithOptions.
+func NewDeleteOptions() *DeleteOptionsBuilder {
+	return &DeleteOptionsBuilder{ops: Options{}}
+}
+
+func (b *DeleteOptionsBuilder) Recursive(recursive bool) *DeleteOptionsBuilder {
+	b.ops["recursive"] = recursive
+	return b
+}
+
+func (b *DeleteOptionsBuilder) Dir(dir bool) *DeleteOptionsBuilder {
+	b.ops["dir"] = dir
+	return b
+}
+
+func (b *DeleteOptionsBuilder) PrevValue(prevValue string) *DeleteOptionsBuilder {
+	b.ops["prevValue"] = prevValue
+	return b
+}
+
+func (b *DeleteOptionsBuilder) PrevIndex(prevIndex uint64) *DeleteOptionsBuilder {
+	b.ops["prevIndex"] = prevIndex
+	return b
+}
+
+// Build validates the options and returns them.
+func (b *DeleteOptionsBuilder) Build() (Options, error) {
+	_, hasPrevValue := b.ops["prevValue"]
+	_, hasPrevIndex := b.ops["prevIndex"]
+
+	// etcd only compares and deletes files
+	if hasPrevValue || hasPrevIndex {
+		for _, k := range []string{"recursive", "dir"} {
+			if v, ok := b.ops[k]; ok && v.(bool) {
+				return nil, fmt.Errorf("Options prevValue and prevIndex cannot be used with %v", k)
+			}
+		}
+	}
+
+	return b.ops.copy(), nil
+}
+
+// copy returns a shallow copy of the options, so that builders
+// can be used again after building.
+func (ops Options) copy() Options {
+	c := make(Options, len(ops))
+	for k, v := range ops {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,124 @@
+package etcd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetOptionsBuilder(t *testing.T) {
+	ops, err := NewGetOptions().Recursive(true).Sorted(true).WaitIndex(42).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Options{
+		"recursive": true,
+		"sorted":    true,
+		"wait":      true,
+		"waitIndex": uint64(42),
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("(actual) %v != (expected) %v", ops, expected)
+	}
+
+	if _, err := ops.toParameters(VALID_GET_OPTIONS); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewGetOptions().Wait(false).WaitIndex(42).Build()
+	if err == nil {
+		t.Fatal("waitIndex without wait should be rejected")
+	}
+}
+
+func TestPutOptionsBuilder(t *testing.T) {
+	ops, err := NewPutOptions().PrevValue("bar").PrevIndex(3).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Options{
+		"prevValue": "bar",
+		"prevIndex": uint64(3),
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("(actual) %v != (expected) %v", ops, expected)
+	}
+
+	if _, err := ops.toParameters(VALID_PUT_OPTIONS); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []*PutOptionsBuilder{
+		NewPutOptions().PrevExist(false).PrevValue("bar"),
+		NewPutOptions().PrevExist(false).PrevIndex(3),
+		NewPutOptions().Dir(true).PrevValue("bar"),
+		NewPutOptions().PrevExist(false).Refresh(true),
+	} {
+		if ops, err := b.Build(); err == nil {
+			t.Fatalf("%v should be rejected", ops)
+		}
+	}
+}
+
+func TestDeleteOptionsBuilder(t *testing.T) {
+	ops, err := NewDeleteOptions().Recursive(true).Dir(true).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Options{
+		"recursive": true,
+		"dir":       true,
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Fatalf("(actual) %v != (expected) %v", ops, expected)
+	}
+
+	if _, err := ops.toParameters(VALID_DELETE_OPTIONS); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range []*DeleteOptionsBuilder{
+		NewDeleteOptions().Recursive(true).PrevValue("bar"),
+		NewDeleteOptions().Dir(true).PrevIndex(3),
+	} {
+		if ops, err := b.Build(); err == nil {
+			t.Fatalf("%v should be rejected", ops)
+		}
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("fooDir", true)
+	}()
+
+	ops, _ := NewPutOptions().PrevExist(false).Build()
+	resp, err := c.PutWithOptions("fooDir/foo", "bar", 5, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Action != "create" {
+		t.Fatalf("PutWithOptions failed: %#v", resp)
+	}
+
+	ops, _ = NewGetOptions().Recursive(true).Sorted(true).Build()
+	resp, err = c.GetWithOptions("fooDir", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(len(resp.Node.Nodes) == 1 && resp.Node.Nodes[0].Value == "bar") {
+		t.Fatalf("GetWithOptions failed: %#v", resp.Node)
+	}
+
+	ops, _ = NewDeleteOptions().Recursive(true).Build()
+	resp, err = c.DeleteWithOptions("fooDir", ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Action != "delete" {
+		t.Fatalf("DeleteWithOptions failed: %#v", resp)
+	}
+}
@@ -0,0 +1,37 @@
+package etcd
+
+import (
+	"sync"
+)
+
+// pollState remembers the last index seen by Poll for every key.
+type pollState struct {
+	sync.Mutex
+	indexes map[string]uint64
+}
+
+func newPollState() *pollState {
+	return &pollState{indexes: make(map[string]uint64)}
+}
+
+// Poll gets the given key and reports whether it changed since the
+// previous Poll of that key by this client, based on its ModifiedIndex.
+// The first Poll of a key always reports a change. For infrequent
+// checks this is simpler than keeping a watch around.
+func (c *Client) Poll(key string) (bool, *Response, error) {
+	resp, err := c.read(key, false, false)
+	if err != nil {
+		return false, nil, err
+	}
+
+	c.polls.Lock()
+	defer c.polls.Unlock()
+
+	last, seen := c.polls.indexes[key]
+	changed := !seen || resp.Node.ModifiedIndex > last
+	if changed {
+		c.polls.indexes[key] = resp.Node.ModifiedIndex
+	}
+
+	return changed, resp, nil
+}
@@ -0,0 +1,40 @@
+package etcd
+
+import (
+	"testing"
+)
+
+func TestPoll(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	c.Set("foo", "bar", 5)
+
+	changed, resp, err := c.Poll("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(changed && resp.Node.Value == "bar") {
+		t.Fatalf("Poll 1 failed: %v %#v", changed, resp.Node)
+	}
+
+	changed, resp, err = c.Poll("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Fatalf("Poll 2 should not report a change: %#v", resp.Node)
+	}
+
+	c.Set("foo", "bar2", 5)
+
+	changed, resp, err = c.Poll("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(changed && resp.Node.Value == "bar2") {
+		t.Fatalf("Poll 3 failed: %v %#v", changed, resp.Node)
+	}
+}
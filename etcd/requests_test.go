@@ -0,0 +1,914 @@
+package etcd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMaxMachinesTried(t *testing.T) {
+	var machines []string
+	for i := 0; i < 10; i++ {
+		machines = append(machines, fmt.Sprintf("http://127.0.0.1:%v", 5001+i))
+	}
+
+	var lock sync.Mutex
+	contacted := make(map[string]bool)
+
+	c := NewClient(machines)
+	c.MaxMachinesTried = 3
+	c.SetTransport(&http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			lock.Lock()
+			contacted[addr] = true
+			lock.Unlock()
+			return nil, errors.New("connection refused")
+		},
+	})
+
+	_, err := c.Get("foo", false, false)
+	if err == nil {
+		t.Fatal("Get should fail when no machine is reachable")
+	}
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeEtcdNotReachable {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(contacted) != 3 {
+		t.Fatalf("expected 3 machines to be contacted, got %v", contacted)
+	}
+}
+
+func TestWithRequestOptions(t *testing.T) {
+	var lock sync.Mutex
+	var traceIDs []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		traceIDs = append(traceIDs, r.Header.Get("X-Trace-Id"))
+		n := len(traceIDs)
+		lock.Unlock()
+
+		// fail the first attempt so that the request is retried
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL, ts.URL})
+
+	header := http.Header{}
+	header.Set("X-Trace-Id", "abc")
+	resp, err := c.WithRequestOptions(RequestOptions{Header: header}).Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "bar" {
+		t.Fatalf("Get failed: %#v", resp)
+	}
+
+	// The header must only be sent for that one call
+	if _, err := c.Get("foo", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if !(len(traceIDs) == 3 && traceIDs[0] == "abc" && traceIDs[1] == "abc" && traceIDs[2] == "") {
+		t.Fatalf("unexpected trace ids: %q", traceIDs)
+	}
+}
+
+func TestRedirectStatusCodes(t *testing.T) {
+	for _, code := range []int{
+		http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect,
+	} {
+		leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "PUT" {
+				t.Errorf("the redirect to the leader changed the method to %v", r.Method)
+			}
+			if value := r.PostFormValue("value"); value != "bar" {
+				t.Errorf("the redirect to the leader changed the value to %q", value)
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"action":"set","node":{"key":"/foo","value":"bar"}}`))
+		}))
+
+		follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, leader.URL+r.URL.Path, code)
+		}))
+
+		c := NewClient([]string{follower.URL, leader.URL})
+		if _, err := c.Set("foo", "bar", 0); err != nil {
+			t.Fatalf("redirect with %v failed: %v", code, err)
+		}
+		if c.cluster.Leader != leader.URL {
+			t.Fatalf("redirect with %v did not update the leader", code)
+		}
+
+		// Only follow the redirects of etcd itself
+		c = NewClient([]string{follower.URL})
+		c.RedirectStatusCodes = []int{http.StatusTemporaryRedirect}
+		_, err := c.Set("foo", "bar", 0)
+		if (err == nil) != (code == http.StatusTemporaryRedirect) {
+			t.Fatalf("redirect with %v should only be followed if configured: %v", code, err)
+		}
+
+		follower.Close()
+		leader.Close()
+	}
+}
+
+func TestLeaderChurn(t *testing.T) {
+	var lock sync.Mutex
+	var hits []string
+
+	// Every leader redirects to the next one, until the last one, which
+	// answers. The third change of leader is one too many, so the client
+	// backs off before sending the request on to the last one.
+	servers := make([]*httptest.Server, 4)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			hits = append(hits, fmt.Sprint(i))
+			lock.Unlock()
+
+			if i < len(servers)-1 {
+				http.Redirect(w, r, servers[i+1].URL+r.URL.Path, http.StatusTemporaryRedirect)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"action":"set","node":{"key":"/foo","value":"bar"}}`))
+		}))
+		defer servers[i].Close()
+	}
+
+	c := NewClient([]string{servers[0].URL, servers[1].URL, servers[2].URL, servers[3].URL})
+	c.MaxLeaderChanges = 2
+	c.RetryBackoff = time.Millisecond
+	c.MaxRetryBackoff = 200 * time.Millisecond
+
+	start := time.Now()
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < c.MaxRetryBackoff {
+		t.Fatalf("the client should have backed off after 3 leader changes, took %v", elapsed)
+	}
+
+	lock.Lock()
+	sent := strings.Join(hits, "")
+	lock.Unlock()
+	if sent != "0123" {
+		t.Fatalf("unexpected requests: %q", sent)
+	}
+
+	// Without churn there is no backoff
+	c.MaxLeaderChanges = 0
+	c.cluster.Leader = servers[1].URL
+	start = time.Now()
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= c.MaxRetryBackoff {
+		t.Fatalf("the client should not back off after 2 leader changes, took %v", elapsed)
+	}
+}
+
+func TestMachineCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword("user", "pass")
+
+	c := NewClient([]string{u.String()})
+
+	var sent []string
+	tr := c.httpClient.Transport
+	c.httpClient.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req.URL.String())
+		return tr.RoundTrip(req)
+	})
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "bar" {
+		t.Fatalf("Get failed: %#v", resp)
+	}
+
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], ts.URL+"/v2/keys/foo?") {
+		t.Fatalf("unexpected request urls: %q", sent)
+	}
+}
+
+func TestStaleReadHook(t *testing.T) {
+	newServer := func(raftIndex string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Raft-Index", raftIndex)
+			if r.Method == "PUT" {
+				w.WriteHeader(http.StatusCreated)
+			}
+			w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+		}))
+	}
+
+	leader := newServer("10")
+	defer leader.Close()
+	follower := newServer("5")
+	defer follower.Close()
+
+	c := NewClient([]string{leader.URL, follower.URL})
+	if err := c.SetConsistency(WEAK_CONSISTENCY); err != nil {
+		t.Fatal(err)
+	}
+
+	var stale []string
+	c.StaleReadHook = func(machine string, raftIndex, knownIndex uint64) {
+		stale = append(stale, fmt.Sprintf("%v %v %v", machine, raftIndex, knownIndex))
+	}
+
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading from the leader is up to date
+	c.SetMachineWeights(map[string]int{follower.URL: 0})
+	if _, err := c.Get("foo", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Fatalf("the hook should not fire for an up to date read: %q", stale)
+	}
+
+	c.SetMachineWeights(map[string]int{leader.URL: 0})
+	if _, err := c.Get("foo", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if !(len(stale) == 1 && stale[0] == follower.URL+" 5 10") {
+		t.Fatalf("the hook should fire for the lagging follower: %q", stale)
+	}
+}
+
+func TestGetHttpPath(t *testing.T) {
+	c := NewClient(nil)
+
+	tests := []struct {
+		machine, path, expected string
+	}{
+		{"http://a:4001", keyToPath("foo"), "http://a:4001/v2/keys/foo"},
+		{"http://a:4001/", keyToPath("/foo"), "http://a:4001/v2/keys/foo"},
+		{"http://a:4001//", keyToPath("//foo//bar/"), "http://a:4001/v2/keys/foo/bar"},
+		{"http://a:4001", keyToPath("/"), "http://a:4001/v2/keys/"},
+		{"http://a:4001/etcd/", "/machines", "http://a:4001/etcd/v2/machines"},
+		{"http://a:4001", keyToPath("foo") + "?prevValue=a//b", "http://a:4001/v2/keys/foo?prevValue=a//b"},
+	}
+
+	for _, test := range tests {
+		if p := c.getHttpPath(test.machine, test.path); p != test.expected {
+			t.Fatalf("getHttpPath(%q, %q) = %q, expected %q", test.machine, test.path, p, test.expected)
+		}
+	}
+
+	// A key with a leading slash is the same key
+	defer func() {
+		c.Delete("slash_foo", true)
+	}()
+
+	if _, err := c.Set("/slash_foo", "bar", 5); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Get("slash_foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Key == "/slash_foo" && resp.Node.Value == "bar") {
+		t.Fatalf("Get failed: %#v", resp.Node)
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	release := make(chan bool)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+
+		if r.URL.Path == "/v2/keys/blocked" {
+			<-release
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.MaxConcurrentRequests = 3
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Get("foo", false, false); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 3 {
+		t.Fatalf("expected at most 3 requests in flight, got %v", maxInFlight)
+	}
+
+	// A request waiting for a slot can be cancelled
+	c.MaxConcurrentRequests = 1
+	done := make(chan bool)
+	go func() {
+		c.Get("blocked", false, false)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel := make(chan bool)
+	close(cancel)
+	_, err := c.SendRequest(NewRawRequest("GET", keyToPath("foo"), nil, cancel))
+	if err != ErrRequestCancelled {
+		t.Fatalf("the waiting request should have been cancelled: %v", err)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestRetryableErrorCodes(t *testing.T) {
+	hits := 0
+	failures := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits <= failures {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errorCode":300,"message":"Raft Internal Error","index":1}`))
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL, ts.URL})
+	c.RetryBackoff = time.Millisecond
+
+	// By default the error is returned right away
+	_, err := c.Get("foo", false, false)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != 300 || hits != 1 {
+		t.Fatalf("the error should not be retried by default: %v after %v requests", err, hits)
+	}
+
+	hits = 0
+	retrying := c.WithRequestOptions(RequestOptions{RetryableErrorCodes: []int{300}})
+	resp, err := retrying.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "bar" && hits == 3) {
+		t.Fatalf("the error should have been retried: %#v after %v requests", resp.Node, hits)
+	}
+
+	// Out of retries, the error itself is returned
+	hits = 0
+	failures = 100
+	_, err = retrying.Get("foo", false, false)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != 300 || hits < 2 {
+		t.Fatalf("the error should be returned after the retries: %v after %v requests", err, hits)
+	}
+}
+
+func TestFormCharset(t *testing.T) {
+	var contentType string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if value := r.PostFormValue("value"); value != "bar" {
+			t.Errorf("the value was sent as %q", value)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"action":"set","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Fatalf("unexpected default Content-Type %q", contentType)
+	}
+
+	c.FormCharset = "utf-8"
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-www-form-urlencoded; charset=utf-8" {
+		t.Fatalf("unexpected Content-Type %q", contentType)
+	}
+}
+
+func TestReadFallbackWeak(t *testing.T) {
+	// Nothing is listening on the leader
+	leader := httptest.NewServer(http.NotFoundHandler())
+	leader.Close()
+
+	// The follower sends consistent reads and writes to the leader
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Query().Get("consistent") != "" {
+			http.Redirect(w, r, leader.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer follower.Close()
+
+	c := NewClient([]string{leader.URL, follower.URL})
+	c.RetryBackoff = time.Millisecond
+	if _, err := c.Get("foo", false, false); err == nil {
+		t.Fatal("Get should fail without ReadFallbackWeak")
+	}
+
+	c = NewClient([]string{leader.URL, follower.URL})
+	c.RetryBackoff = time.Millisecond
+	c.ReadFallbackWeak = true
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "bar" && resp.ServedByFollower) {
+		t.Fatalf("Get should have fallen back to the follower: %#v", resp)
+	}
+
+	c.cluster.Leader = leader.URL
+	if _, err := c.Set("foo", "bar", 0); err == nil {
+		t.Fatal("Set should never fall back to the follower")
+	}
+}
+
+func TestWeakPath(t *testing.T) {
+	tests := map[string]string{
+		"keys/foo":                 "keys/foo",
+		"keys/foo?consistent=true": "keys/foo",
+		"keys/foo?consistent=true&recursive=true":     "keys/foo?recursive=true",
+		"keys/foo?quorum=true&sorted=false&wait=true": "keys/foo?sorted=false&wait=true",
+	}
+
+	for p, expected := range tests {
+		if actual := weakPath(p); actual != expected {
+			t.Fatalf("weakPath(%q) = %q, expected %q", p, actual, expected)
+		}
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	var lock sync.Mutex
+	var ids []string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		ids = append(ids, r.Header.Get("X-Request-Id"))
+		n := len(ids)
+		lock.Unlock()
+
+		// fail every other attempt so that each request is retried once
+		if n%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL, ts.URL})
+	c.RetryBackoff = time.Millisecond
+
+	if _, err := c.Get("foo", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if !(len(ids) == 2 && ids[0] == "" && ids[1] == "") {
+		t.Fatalf("no request id should be sent by default: %q", ids)
+	}
+
+	c.RequestIDs = true
+	first, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if !(len(ids) == 6 && len(ids[2]) == 36 && ids[2] == ids[3] && ids[4] == ids[5] && ids[3] != ids[4]) {
+		t.Fatalf("the request id should be stable across retries only: %q", ids)
+	}
+	if !(first.RequestID == ids[2] && second.RequestID == ids[4]) {
+		t.Fatalf("the responses should carry the request ids: %q %q", first.RequestID, second.RequestID)
+	}
+}
+
+func TestRetryableStatusCodes(t *testing.T) {
+	// The load balancer in front of etcd fails twice
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.RetryBackoff = time.Millisecond
+	c.RetryableStatusCodes = []int{http.StatusBadGateway}
+	// a single machine is only tried twice by default
+	c.CheckRetry = func(cluster *Cluster, numReqs int, lastResp http.Response, err error) error {
+		if numReqs >= 5 {
+			return err
+		}
+		return nil
+	}
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "bar" && hits == 3) {
+		t.Fatalf("Get returned %v after %v requests", resp.Node.Value, hits)
+	}
+
+	// Other status codes fail right away
+	hits = 0
+	c.RetryableStatusCodes = []int{}
+	if _, err := c.Get("foo", false, false); err == nil {
+		t.Fatal("Get should fail on a status code which is not retryable")
+	}
+	if hits != 1 {
+		t.Fatalf("Get sent %v requests, expected 1", hits)
+	}
+}
+
+func TestKeyToPath(t *testing.T) {
+	tests := []struct {
+		key, expected string
+	}{
+		{"foo", "keys/foo"},
+		{"/foo/bar/", "keys/foo/bar"},
+		{"a/./b/../c", "keys/a/c"},
+		{"../stats/self", "keys/stats/self"},
+		{"a/../../b", "keys/b"},
+		{"..", "keys/"},
+		{"", "keys/"},
+	}
+
+	for _, test := range tests {
+		if p := keyToPath(test.key); p != test.expected {
+			t.Errorf("keyToPath(%q) = %q, expected %q", test.key, p, test.expected)
+		}
+	}
+}
+
+func TestStrictKeys(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	// By default the key is normalized, and stays under the keys
+	if _, err := c.Get("../stats/self", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if !(len(paths) == 1 && paths[0] == "/v2/keys/stats/self") {
+		t.Fatalf("unexpected requests: %q", paths)
+	}
+
+	c.StrictKeys = true
+	paths = nil
+	for _, key := range []string{"../stats/self", "a/./b", "a/..", "a\nb", "a\x7fb"} {
+		if _, err := c.Get(key, false, false); err != ErrInvalidKey {
+			t.Errorf("Get(%q) should fail with ErrInvalidKey, not %v", key, err)
+		}
+		if _, err := c.Set(key, "bar", 0); err != ErrInvalidKey {
+			t.Errorf("Set(%q) should fail with ErrInvalidKey, not %v", key, err)
+		}
+		if _, err := c.Delete(key, false); err != ErrInvalidKey {
+			t.Errorf("Delete(%q) should fail with ErrInvalidKey, not %v", key, err)
+		}
+	}
+	if len(paths) != 0 {
+		t.Fatalf("invalid keys should not be sent: %q", paths)
+	}
+
+	for _, key := range []string{"foo", "/foo/bar/", "a..b/.c/d.", "ключ"} {
+		if _, err := c.Get(key, false, false); err != nil {
+			t.Errorf("Get(%q) failed: %v", key, err)
+		}
+	}
+}
+
+func TestMaxKeyLength(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	// The escaped path counts: each % takes three bytes
+	long := strings.Repeat("a", 5000)
+	escaped := strings.Repeat("%", 1500)
+	for _, key := range []string{long, escaped} {
+		if _, err := c.Get(key, false, false); err != ErrKeyTooLong {
+			t.Errorf("Get of a %v byte key should fail with ErrKeyTooLong, not %v", len(key), err)
+		}
+		if _, err := c.Set(key, "bar", 0); err != ErrKeyTooLong {
+			t.Errorf("Set of a %v byte key should fail with ErrKeyTooLong, not %v", len(key), err)
+		}
+	}
+	if len(paths) != 0 {
+		t.Fatalf("too long keys should not be sent: %v requests", len(paths))
+	}
+
+	// /v2/keys/ and the key make up the limit
+	c.MaxKeyLength = 20
+	if _, err := c.Get("12345678901", false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get("123456789012", false, false); err != ErrKeyTooLong {
+		t.Fatalf("Get of a 21 byte path should fail with ErrKeyTooLong, not %v", err)
+	}
+
+	c.MaxKeyLength = -1
+	if _, err := c.Get(long, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("unexpected requests: %v", len(paths))
+	}
+}
+
+func TestRedirectToSelf(t *testing.T) {
+	// A misconfigured proxy redirects to itself
+	loopHits := 0
+	var loop *httptest.Server
+	loop = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loopHits++
+		http.Redirect(w, r, loop.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer loop.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	// The client moves on to the other machine
+	c := NewClient([]string{loop.URL, ts.URL})
+	c.RetryBackoff = time.Millisecond
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "bar" && loopHits == 1 && c.cluster.Leader == ts.URL) {
+		t.Fatalf("Get returned %v after %v redirects, leader %v", resp.Node.Value, loopHits, c.cluster.Leader)
+	}
+
+	// and gives up if there is none
+	loopHits = 0
+	c = NewClient([]string{loop.URL})
+	c.RetryBackoff = time.Millisecond
+	if _, err := c.Get("foo", false, false); err == nil {
+		t.Fatal("Get should fail when the only machine redirects to itself")
+	}
+	if loopHits != 3 {
+		t.Fatalf("Get followed %v redirects, expected 3", loopHits)
+	}
+}
+
+func TestRecordTimeline(t *testing.T) {
+	// The leader is busy at first
+	leaderHits := 0
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaderHits++
+		if leaderHits == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer leader.Close()
+
+	follower := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, leader.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer follower.Close()
+
+	c := NewClient([]string{follower.URL, leader.URL})
+	c.RetryBackoff = time.Millisecond
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Timeline != nil {
+		t.Fatalf("the timeline should only be recorded on request: %v", resp.Timeline)
+	}
+
+	c = NewClient([]string{follower.URL, leader.URL})
+	c.RetryBackoff = time.Millisecond
+	c.RecordTimeline = true
+	leaderHits = 0
+
+	start := time.Now()
+	resp, err = c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		machine string
+		code    int
+	}{
+		{follower.URL, http.StatusTemporaryRedirect},
+		{leader.URL, http.StatusServiceUnavailable},
+		{leader.URL, http.StatusOK},
+	}
+	if len(resp.Timeline) != len(expected) {
+		t.Fatalf("the timeline has %v attempts, expected %v: %v", len(resp.Timeline), len(expected), resp.Timeline)
+	}
+	for i, a := range resp.Timeline {
+		if !(a.Machine == expected[i].machine && a.StatusCode == expected[i].code && a.Err == nil) {
+			t.Errorf("unexpected attempt %v: %+v", i+1, a)
+		}
+		if a.Start.Before(start) || a.Duration <= 0 {
+			t.Errorf("attempt %v has bad times: %+v", i+1, a)
+		}
+		start = a.Start.Add(a.Duration)
+	}
+}
+
+func TestRetryDefaults(t *testing.T) {
+	tests := []struct {
+		machines   int
+		retries    int
+		maxBackoff time.Duration
+	}{
+		{1, 2, time.Second / 2},
+		{3, 4, time.Second},
+		{9, 8, 3 * time.Second},
+	}
+
+	for _, test := range tests {
+		var machines []string
+		for i := 0; i < test.machines; i++ {
+			machines = append(machines, fmt.Sprintf("http://127.0.0.1:%v", 5001+i))
+		}
+		c := NewClient(machines)
+
+		if retries := c.maxRetries(); retries != test.retries {
+			t.Errorf("%v machines: %v retries, expected %v", test.machines, retries, test.retries)
+		}
+		if max := c.newBackoff().maxSleep; max != test.maxBackoff {
+			t.Errorf("%v machines: a backoff of at most %v, expected %v", test.machines, max, test.maxBackoff)
+		}
+
+		// The default CheckRetry gives up after the retries
+		checkRetry := c.retryPolicy()
+		for numReqs := 2; numReqs <= test.retries+1; numReqs++ {
+			if err := checkRetry(c.cluster, numReqs, http.Response{}, nil); err != nil {
+				t.Errorf("%v machines: request %v should be retried: %v", test.machines, numReqs-1, err)
+			}
+		}
+		if err := checkRetry(c.cluster, test.retries+2, http.Response{}, nil); err == nil {
+			t.Errorf("%v machines: request %v should not be retried", test.machines, test.retries+1)
+		}
+
+		c.MaxRetries = 5
+		c.MaxRetryBackoff = time.Minute
+		if !(c.maxRetries() == 5 && c.newBackoff().maxSleep == time.Minute) {
+			t.Errorf("%v machines: the defaults should be overridden", test.machines)
+		}
+		c.MaxRetries = -1
+		if err := checkRetry(c.cluster, 2, http.Response{}, nil); err == nil {
+			t.Errorf("%v machines: no request should be retried", test.machines)
+		}
+	}
+}
+
+// maintenanceError is how TestUnknownResponseHandler classifies the
+// maintenance page of a proxy.
+type maintenanceError struct {
+	status int
+}
+
+func (e *maintenanceError) Error() string {
+	return fmt.Sprintf("proxy in maintenance (%v), retry later", e.status)
+}
+
+func TestUnknownResponseHandler(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/v2/keys/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<html><body>No such page</body></html>")
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "<html><body>Down for maintenance</body></html>")
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.RetryBackoff = time.Millisecond
+
+	// By default the page is retried, then reported generically
+	_, err := c.Get("foo", false, false)
+	if _, ok := err.(*maintenanceError); ok || err == nil {
+		t.Fatalf("Get without a handler returned %v", err)
+	}
+
+	var statuses []int
+	c.UnknownResponseHandler = func(status int, body []byte) error {
+		statuses = append(statuses, status)
+		if strings.Contains(string(body), "maintenance") {
+			return &maintenanceError{status: status}
+		}
+		return nil
+	}
+
+	hits = 0
+	_, err = c.Get("foo", false, false)
+	if e, ok := err.(*maintenanceError); !ok || e.status != http.StatusServiceUnavailable {
+		t.Fatalf("Get returned %#v, expected a *maintenanceError", err)
+	}
+	if hits != 1 {
+		t.Fatalf("the classified page was requested %v times, expected once", hits)
+	}
+
+	// A status etcd uses, with a body etcd would not send
+	_, err = c.Get("missing", false, false)
+	if _, ok := err.(*EtcdError); ok || err == nil {
+		t.Fatalf("Get of an HTML 404 returned %v, expected the parse error", err)
+	}
+
+	expected := []int{http.StatusServiceUnavailable, http.StatusNotFound}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("the handler was given %v, expected %v", statuses, expected)
+	}
+}
@@ -1,9 +1,11 @@
 package etcd
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +20,42 @@ type RawResponse struct {
 	StatusCode int
 	Body       []byte
 	Header     http.Header
+	// ServedByFollower is set if the leader could not be reached and
+	// another machine answered the read, see Client.ReadFallbackWeak.
+	ServedByFollower bool
+	// RequestID is the X-Request-Id sent with the request, if any, see
+	// Client.RequestIDs.
+	RequestID string
+	// Timeline holds every attempt made to send the request, in order,
+	// if Client.RecordTimeline is set.
+	Timeline []Attempt
+	// LeaderStats are the statistics of the leader fetched after a
+	// write, if Client.AttachLeaderStats is set.
+	LeaderStats *LeaderSummary
+	// decoder is the Client.Decoder of the client which sent the request.
+	decoder func([]byte, *Response) error
+	// aliases are the Client.FieldAliases of the client which sent the
+	// request.
+	aliases map[string]string
+	// unknown is the Client.UnknownResponseHandler of the client which
+	// sent the request.
+	unknown func(int, []byte) error
+	// wait is set on the responses to watches.
+	wait bool
+}
+
+// Attempt describes one attempt to send a request, see
+// Client.RecordTimeline.
+type Attempt struct {
+	Machine string
+	Start   time.Time
+	// Duration is the time until the headers of the response arrived,
+	// or the request failed.
+	Duration time.Duration
+	// StatusCode is the status code of the response, or zero if Err is
+	// set.
+	StatusCode int
+	Err        error
 }
 
 var (
@@ -31,28 +69,104 @@ var (
 	}
 )
 
-// Unmarshal parses RawResponse and stores the result in Response
+// newRawResponse reads the given http.Response into a RawResponse
+// and closes its body.
+func newRawResponse(resp *http.Response) (*RawResponse, error) {
+	defer resp.Body.Close()
+
+	b, err := readBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RawResponse{
+		StatusCode: resp.StatusCode,
+		Body:       b,
+		Header:     resp.Header,
+	}, nil
+}
+
+// etcdIndex returns the index of the machine which sent the response.
+// Errors reported by etcd carry it in their body.
+func (rr *RawResponse) etcdIndex() (uint64, error) {
+	if index := rr.Header.Get("X-Etcd-Index"); index != "" {
+		return strconv.ParseUint(index, 10, 64)
+	}
+
+	etcdErr := new(EtcdError)
+	if err := json.Unmarshal(rr.Body, etcdErr); err != nil {
+		return 0, err
+	}
+	return etcdErr.Index, nil
+}
+
+// Unmarshal parses RawResponse and stores the result in Response.
+// A successful response with an empty body, as sent for
+// noValueOnSuccess, yields a Response with only the indexes set, unless
+// it answers a watch: etcd sends such a response when a watch timed out
+// without a change, for which ErrWatchTimedOut is returned.
 func (rr *RawResponse) Unmarshal() (*Response, error) {
 	if rr.StatusCode != http.StatusOK && rr.StatusCode != http.StatusCreated {
-		return nil, handleError(rr.Body)
+		err := handleError(rr.Body)
+		if _, ok := err.(*EtcdError); !ok {
+			err = rr.unknownResponse(err)
+		}
+		return nil, err
+	}
+
+	empty := len(bytes.TrimSpace(rr.Body)) == 0
+	if empty && rr.wait {
+		return nil, ErrWatchTimedOut
 	}
 
 	resp := new(Response)
 
-	err := json.Unmarshal(rr.Body, resp)
+	if !empty {
+		body, err := applyFieldAliases(rr.Body, rr.aliases)
+		if err != nil {
+			return nil, rr.unknownResponse(err)
+		}
 
-	if err != nil {
-		return nil, err
+		decode := rr.decoder
+		if decode == nil {
+			decode = decodeResponse
+		}
+		if err := decode(body, resp); err != nil {
+			return nil, rr.unknownResponse(err)
+		}
 	}
 
 	// attach index and term to response
 	resp.EtcdIndex, _ = strconv.ParseUint(rr.Header.Get("X-Etcd-Index"), 10, 64)
 	resp.RaftIndex, _ = strconv.ParseUint(rr.Header.Get("X-Raft-Index"), 10, 64)
 	resp.RaftTerm, _ = strconv.ParseUint(rr.Header.Get("X-Raft-Term"), 10, 64)
+	resp.ServedByFollower = rr.ServedByFollower
+	resp.RequestID = rr.RequestID
+	resp.Timeline = rr.Timeline
+	resp.LeaderStats = rr.LeaderStats
 
 	return resp, nil
 }
 
+// unknownResponse hands a body which failed to parse with err to the
+// Client.UnknownResponseHandler, if any, and returns the error it
+// returns instead of err.
+func (rr *RawResponse) unknownResponse(err error) error {
+	if rr.unknown == nil {
+		return err
+	}
+
+	if handlerErr := rr.unknown(rr.StatusCode, rr.Body); handlerErr != nil {
+		return handlerErr
+	}
+	return err
+}
+
+// decodeResponse is the default Client.Decoder.
+func decodeResponse(b []byte, resp *Response) error {
+	return json.Unmarshal(b, resp)
+}
+
 type Response struct {
 	Action    string `json:"action"`
 	Node      *Node  `json:"node"`
@@ -60,6 +174,22 @@ type Response struct {
 	EtcdIndex uint64 `json:"etcdIndex"`
 	RaftIndex uint64 `json:"raftIndex"`
 	RaftTerm  uint64 `json:"raftTerm"`
+	// Truncated is set if nodes were left out of the response,
+	// see Client.GetLimited.
+	Truncated bool `json:"-"`
+	// ServedByFollower is set if the leader could not be reached and
+	// another machine answered the read, which may thus be stale, see
+	// Client.ReadFallbackWeak.
+	ServedByFollower bool `json:"-"`
+	// RequestID is the X-Request-Id sent with the request, if any, see
+	// Client.RequestIDs.
+	RequestID string `json:"-"`
+	// Timeline holds every attempt made to send the request, in order,
+	// if Client.RecordTimeline is set.
+	Timeline []Attempt `json:"-"`
+	// LeaderStats are the statistics of the leader fetched after a
+	// write, if Client.AttachLeaderStats is set.
+	LeaderStats *LeaderSummary `json:"-"`
 }
 
 type Node struct {
@@ -73,6 +203,196 @@ type Node struct {
 	CreatedIndex  uint64     `json:"createdIndex,omitempty"`
 }
 
+// NodeKind tells keys and directories apart, see Node.Kind.
+type NodeKind int
+
+const (
+	FileNode NodeKind = iota
+	DirNode
+)
+
+func (k NodeKind) String() string {
+	if k == DirNode {
+		return "dir"
+	}
+	return "file"
+}
+
+// Kind reports whether the node is a key, possibly with an empty value,
+// or a directory. Only the dir flag sent by etcd decides, never the value.
+func (n *Node) Kind() NodeKind {
+	if n.Dir {
+		return DirNode
+	}
+	return FileNode
+}
+
+// String renders the response for people to read, e.g. in command line
+// tools: the action and the etcd index, followed by the tree of the node
+// and, if any, of the previous node, as Node.String renders them.
+func (r *Response) String() string {
+	var b bytes.Buffer
+	b.WriteString(r.Action + ", etcd index " + strconv.FormatUint(r.EtcdIndex, 10) + "\n")
+	if r.Node != nil {
+		r.Node.writeTree(&b, "")
+	}
+	if r.PrevNode != nil {
+		b.WriteString("previous:\n")
+		r.PrevNode.writeTree(&b, "  ")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// String renders the tree rooted at the node for people to read, one
+// node per line, each indented two spaces below its directory.
+// Directories end with a slash and values are quoted, followed by the
+// TTL, if any, and the indexes of the node, e.g.
+//
+//	/foo/
+//	  /foo/bar = "baz" (ttl 5, modified 7, created 6)
+func (n *Node) String() string {
+	var b bytes.Buffer
+	n.writeTree(&b, "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (n *Node) writeTree(b *bytes.Buffer, indent string) {
+	b.WriteString(indent + n.Key)
+	if !n.Dir {
+		b.WriteString(" = " + strconv.Quote(n.Value))
+	} else if !strings.HasSuffix(n.Key, "/") {
+		b.WriteString("/")
+	}
+
+	b.WriteString(" (")
+	if n.TTL > 0 {
+		b.WriteString("ttl " + strconv.FormatInt(n.TTL, 10) + ", ")
+	}
+	b.WriteString("modified " + strconv.FormatUint(n.ModifiedIndex, 10) +
+		", created " + strconv.FormatUint(n.CreatedIndex, 10) + ")\n")
+
+	for _, child := range n.Nodes {
+		child.writeTree(b, indent+"  ")
+	}
+}
+
+// applyFieldAliases renames the fields of the given JSON document, and
+// of every object within, according to aliases, see Client.FieldAliases.
+func applyFieldAliases(b []byte, aliases map[string]string) ([]byte, error) {
+	if len(aliases) == 0 {
+		return b, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// the indexes do not fit in a float64
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(renameFields(doc, aliases))
+}
+
+// renameFields renames the fields of the objects in the given decoded
+// JSON value, see applyFieldAliases.
+func renameFields(v interface{}, aliases map[string]string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for name, value := range v {
+			if alias, ok := aliases[name]; ok {
+				name = alias
+			}
+			renamed[name] = renameFields(value, aliases)
+		}
+		return renamed
+	case []interface{}:
+		for i, value := range v {
+			v[i] = renameFields(value, aliases)
+		}
+	}
+	return v
+}
+
+// CountLeaves returns the number of leaf nodes in the tree rooted at
+// the node, that is nodes without any children. Empty directories are
+// counted as leaves. This is mostly useful on the PrevNode of a
+// recursive delete to find out how much was removed.
+func (n *Node) CountLeaves() int {
+	return n.countLeavesWhere(nil)
+}
+
+// countLeavesWhere counts the leaf nodes of the tree rooted at the node
+// for which pred returns true, or all of them if pred is nil.
+func (n *Node) countLeavesWhere(pred func(*Node) bool) int {
+	if len(n.Nodes) == 0 {
+		if pred == nil || pred(n) {
+			return 1
+		}
+		return 0
+	}
+
+	count := 0
+	for _, child := range n.Nodes {
+		count += child.countLeavesWhere(pred)
+	}
+	return count
+}
+
+// leavesWhere returns the leaf nodes of the tree rooted at the node for
+// which pred returns true, depth-first.
+func (n *Node) leavesWhere(pred func(*Node) bool) []*Node {
+	if len(n.Nodes) == 0 {
+		if pred(n) {
+			return []*Node{n}
+		}
+		return nil
+	}
+
+	var leaves []*Node
+	for _, child := range n.Nodes {
+		leaves = append(leaves, child.leavesWhere(pred)...)
+	}
+	return leaves
+}
+
+// truncate drops the nodes of the tree beyond the first max leaves,
+// walking it depth-first. It returns the number of leaves kept and
+// whether anything was dropped.
+func (n *Node) truncate(max int) (int, bool) {
+	if len(n.Nodes) == 0 {
+		return 1, false
+	}
+
+	kept := 0
+	for i, child := range n.Nodes {
+		if kept == max {
+			n.Nodes = n.Nodes[:i]
+			return kept, true
+		}
+
+		count, truncated := child.truncate(max - kept)
+		kept += count
+		if truncated {
+			n.Nodes = n.Nodes[:i+1]
+			return kept, true
+		}
+	}
+
+	return kept, false
+}
+
+// trimValues strips the surrounding whitespace from the values of the
+// tree rooted at the node.
+func (n *Node) trimValues() {
+	n.Value = strings.TrimSpace(n.Value)
+	for _, child := range n.Nodes {
+		child.trimValues()
+	}
+}
+
 type Nodes []*Node
 
 // interfaces for sorting
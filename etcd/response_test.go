@@ -0,0 +1,274 @@
+package etcd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCountLeaves(t *testing.T) {
+	prevNode := &Node{
+		Key: "/fooDir",
+		Dir: true,
+		Nodes: Nodes{
+			&Node{Key: "/fooDir/k0", Value: "v0"},
+			&Node{
+				Key: "/fooDir/childDir",
+				Dir: true,
+				Nodes: Nodes{
+					&Node{Key: "/fooDir/childDir/k1", Value: "v1"},
+					&Node{Key: "/fooDir/childDir/k2", Value: "v2"},
+				},
+			},
+			&Node{Key: "/fooDir/emptyDir", Dir: true},
+		},
+	}
+
+	if count := prevNode.CountLeaves(); count != 4 {
+		t.Fatalf("CountLeaves failed: expected 4, got %v", count)
+	}
+
+	leaf := &Node{Key: "/foo", Value: "bar"}
+	if count := leaf.CountLeaves(); count != 1 {
+		t.Fatalf("CountLeaves on a single key failed: expected 1, got %v", count)
+	}
+}
+
+func TestFieldAliases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Action":"set",
+			"Node":{"key":"/fooDir","dir":true,"modified_index":7,"children":[
+				{"key":"/fooDir/foo","value":"bar","modified_index":7}]},
+			"prev_node":{"key":"/fooDir","dir":true,"modified_index":3}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.FieldAliases = map[string]string{
+		"prev_node":      "prevNode",
+		"modified_index": "modifiedIndex",
+		"children":       "nodes",
+	}
+
+	resp, err := c.Get("fooDir", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Response{
+		Action: "set",
+		Node: &Node{Key: "/fooDir", Dir: true, ModifiedIndex: 7, Nodes: Nodes{
+			&Node{Key: "/fooDir/foo", Value: "bar", ModifiedIndex: 7}}},
+		PrevNode: &Node{Key: "/fooDir", Dir: true, ModifiedIndex: 3},
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Fatalf("Unmarshal failed: %#v %#v", resp.Node, resp.PrevNode)
+	}
+
+	// The streamed trees are renamed too
+	node, err := c.FindFirst("fooDir", func(n *Node) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(node != nil && node.Key == "/fooDir/foo" && node.ModifiedIndex == 7) {
+		t.Fatalf("FindFirst failed: %#v", node)
+	}
+
+	// The aliases of a client do not apply to another one
+	resp, err = NewClient([]string{ts.URL}).Get("fooDir", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.PrevNode != nil || len(resp.Node.Nodes) != 0 {
+		t.Fatalf("the aliases of another client were applied: %#v", resp)
+	}
+}
+
+func TestUnmarshalEmptyBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Etcd-Index", "12")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	resp, err := c.Set("foo", "bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node == nil && resp.EtcdIndex == 12) {
+		t.Fatalf("Unmarshal of an empty body failed: %#v", resp)
+	}
+
+	// An empty error response is still an error
+	raw := &RawResponse{StatusCode: http.StatusNotFound, Header: http.Header{}}
+	if _, err := raw.Unmarshal(); err == nil {
+		t.Fatal("Unmarshal of an empty error response should fail")
+	}
+}
+
+func TestEmptyBodyHelpers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Etcd-Index", "12")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.QuietSet = true
+
+	// The helpers which need a node fail instead of panicking
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Append("foo", "bar", 0); err != ErrNoNode {
+		t.Fatalf("Append returned %v, expected ErrNoNode", err)
+	}
+	if _, _, err := c.AcquireLock("foo", "me", 5); err != ErrNoNode {
+		t.Fatalf("AcquireLock returned %v, expected ErrNoNode", err)
+	}
+	if err := c.SwapValues("foo", "bar"); err != ErrNoNode {
+		t.Fatalf("SwapValues returned %v, expected ErrNoNode", err)
+	}
+	if _, _, err := c.CreateEphemeralSeq("foo", "bar", 5); err != ErrNoNode {
+		t.Fatalf("CreateEphemeralSeq returned %v, expected ErrNoNode", err)
+	}
+}
+
+func TestNodeKind(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("kind_foo", true)
+	}()
+
+	c.Delete("kind_foo", true)
+	c.Set("kind_foo/empty", "", 5)
+	c.CreateDir("kind_foo/dir", 5)
+
+	resp, err := c.Get("kind_foo", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Kind() != DirNode {
+		t.Fatalf("kind_foo should be a directory: %#v", resp.Node)
+	}
+
+	kinds := make(map[string]NodeKind)
+	for _, n := range resp.Node.Nodes {
+		if n.Value != "" {
+			t.Fatalf("unexpected value %q for %v", n.Value, n.Key)
+		}
+		kinds[n.Key] = n.Kind()
+	}
+	if !(len(kinds) == 2 && kinds["/kind_foo/empty"] == FileNode && kinds["/kind_foo/dir"] == DirNode) {
+		t.Fatalf("unexpected kinds: %v", kinds)
+	}
+
+	resp, err = c.Get("kind_foo/empty", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Kind() != FileNode {
+		t.Fatalf("the empty key should be a file: %#v", resp.Node)
+	}
+
+	// An empty key does not count as an empty directory
+	if err := c.WaitForEmpty("kind_foo/empty", 0, nil); err == nil {
+		t.Fatal("WaitForEmpty should fail on a key")
+	}
+
+	// Nor does it come out of an export as one
+	data, err := c.Export("kind_foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"nodes":[{"key":"/kind_foo/dir","dir":true},{"key":"/kind_foo/empty"}]}` {
+		t.Fatalf("unexpected export: %s", data)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Etcd-Index", "7")
+		if r.URL.Path == "/v2/keys/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":100,"message":"Key not found","index":7}`))
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	var decoded []string
+	c.Decoder = func(body []byte, resp *Response) error {
+		decoded = append(decoded, string(body))
+		if err := json.Unmarshal(body, resp); err != nil {
+			return err
+		}
+		resp.Node.Value = strings.ToUpper(resp.Node.Value)
+		return nil
+	}
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("the decoder was called %v times, expected once", len(decoded))
+	}
+	if !(resp.Action == "get" && resp.Node.Value == "BAR" && resp.EtcdIndex == 7) {
+		t.Fatalf("the response was not decoded by the decoder: %#v", resp)
+	}
+
+	// Errors are not decoded by the decoder
+	_, err = c.Get("missing", false, false)
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+		t.Fatalf("Get should fail with ErrCodeKeyNotFound, not %v", err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("the decoder was called for an error")
+	}
+}
+
+func TestResponseString(t *testing.T) {
+	resp := &Response{
+		Action:    "get",
+		EtcdIndex: 12,
+		Node: &Node{
+			Key: "/foo", Dir: true, ModifiedIndex: 3, CreatedIndex: 3,
+			Nodes: Nodes{
+				&Node{Key: "/foo/a", Value: "1", TTL: 5, ModifiedIndex: 10, CreatedIndex: 4},
+				&Node{
+					Key: "/foo/dir", Dir: true, ModifiedIndex: 5, CreatedIndex: 5,
+					Nodes: Nodes{
+						&Node{Key: "/foo/dir/b", Value: "two\nlines", ModifiedIndex: 6, CreatedIndex: 6},
+					},
+				},
+			},
+		},
+		PrevNode: &Node{Key: "/foo/a", Value: "0", ModifiedIndex: 4, CreatedIndex: 4},
+	}
+
+	expected := `get, etcd index 12
+/foo/ (modified 3, created 3)
+  /foo/a = "1" (ttl 5, modified 10, created 4)
+  /foo/dir/ (modified 5, created 5)
+    /foo/dir/b = "two\nlines" (modified 6, created 6)
+previous:
+  /foo/a = "0" (modified 4, created 4)`
+	if resp.String() != expected {
+		t.Fatalf("Response.String rendered\n%v\nexpected\n%v", resp, expected)
+	}
+
+	expected = `/foo/dir/ (modified 5, created 5)
+  /foo/dir/b = "two\nlines" (modified 6, created 6)`
+	if s := resp.Node.Nodes[1].String(); s != expected {
+		t.Fatalf("Node.String rendered\n%v\nexpected\n%v", s, expected)
+	}
+}
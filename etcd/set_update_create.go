@@ -1,9 +1,25 @@
 package etcd
 
+import (
+	"errors"
+	"path"
+	"strconv"
+)
+
+// Errors introduced by slot reservations
+var (
+	ErrNoSlots = errors.New("All the slots are taken")
+)
+
 // Set sets the given key to the given value.
 // It will create a new key value pair or replace the old one.
 // It will not replace a existing directory.
+// See Client.QuietSet for how repeated identical Sets are handled.
 func (c *Client) Set(key string, value string, ttl uint64) (*Response, error) {
+	if c.QuietSet {
+		return c.quietSet(key, value, ttl)
+	}
+
 	raw, err := c.RawSet(key, value, ttl)
 
 	if err != nil {
@@ -62,6 +78,19 @@ func (c *Client) Create(key string, value string, ttl uint64) (*Response, error)
 	return raw.Unmarshal()
 }
 
+// EnsureKey creates a file with the given value under the given key,
+// unless the key already exists. An existing key is left untouched
+// and is not considered an error, whatever its value.
+func (c *Client) EnsureKey(key string, value string, ttl uint64) error {
+	_, err := c.Create(key, value, ttl)
+
+	if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyAlreadyExists {
+		return nil
+	}
+
+	return err
+}
+
 // CreateInOrder creates a file with a key that's guaranteed to be higher than other
 // keys in the given directory. It is useful for creating queues.
 func (c *Client) CreateInOrder(dir string, value string, ttl uint64) (*Response, error) {
@@ -74,6 +103,47 @@ func (c *Client) CreateInOrder(dir string, value string, ttl uint64) (*Response,
 	return raw.Unmarshal()
 }
 
+// CreateEphemeralSeq creates a file under the given directory, like
+// CreateInOrder, which expires after ttl unless it is refreshed, e.g.
+// with RawRefresh or RefreshAll. It returns the key created, whose
+// ordered name makes it a fair place in a queue or a lock, which is
+// given up if its holder dies. The ttl must not be zero.
+func (c *Client) CreateEphemeralSeq(dir, value string, ttl uint64) (key string, resp *Response, err error) {
+	if ttl == 0 {
+		return "", nil, errors.New("An ephemeral node needs a TTL")
+	}
+
+	resp, err = c.CreateInOrder(dir, value, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.Node == nil {
+		return "", nil, ErrNoNode
+	}
+
+	return resp.Node.Key, resp, nil
+}
+
+// ReserveSlot reserves the first free numbered slot of the given
+// directory, from start up to but not including end, by creating the key
+// dir/N holding value, and returns its number N. Slots given up, by
+// deleting their key or letting their ttl run out, are reused. If every
+// slot is taken, ErrNoSlots is returned.
+func (c *Client) ReserveSlot(dir string, start, end int, value string, ttl uint64) (int, error) {
+	for n := start; n < end; n++ {
+		_, err := c.Create(path.Join(dir, strconv.Itoa(n)), value, ttl)
+		if err == nil {
+			return n, nil
+		}
+
+		if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyAlreadyExists {
+			return 0, err
+		}
+	}
+
+	return 0, ErrNoSlots
+}
+
 // Update updates the given key to the given value.  It succeeds only if the
 // given key already exists.
 func (c *Client) Update(key string, value string, ttl uint64) (*Response, error) {
@@ -86,6 +156,87 @@ func (c *Client) Update(key string, value string, ttl uint64) (*Response, error)
 	return raw.Unmarshal()
 }
 
+// PutWithOptions puts the given value under the given key with the
+// given options, see NewPutOptions.
+func (c *Client) PutWithOptions(key string, value string, ttl uint64,
+	options Options) (*Response, error) {
+	raw, err := c.put(key, value, ttl, options)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return raw.Unmarshal()
+}
+
+// quietSet behaves like Set, except that it leaves a key which already
+// holds the given value alone. If the key has no TTL and none is given,
+// the current node is returned without writing anything. If a TTL is
+// given, the key is refreshed, which extends the TTL without notifying
+// watchers.
+func (c *Client) quietSet(key string, value string, ttl uint64) (*Response, error) {
+	resp, err := c.read(key, false, false)
+	if err == nil && !resp.Node.Dir && resp.Node.Value == value {
+		if ttl == 0 && resp.Node.Expiration == nil {
+			return resp, nil
+		}
+
+		if ttl > 0 {
+			raw, err := c.RawRefresh(key, ttl)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err = raw.Unmarshal()
+			if err == nil {
+				return resp, nil
+			}
+
+			// The key might have expired in the meantime,
+			// in which case it simply has to be set again.
+			if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+				return nil, err
+			}
+		}
+	}
+
+	raw, err := c.RawSet(key, value, ttl)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return raw.Unmarshal()
+}
+
+// RawRefresh resets the TTL of an existing key without changing its
+// value and without notifying watchers.
+func (c *Client) RawRefresh(key string, ttl uint64) (*RawResponse, error) {
+	ops := Options{
+		"refresh":   true,
+		"prevExist": true,
+	}
+
+	return c.put(key, "", ttl, ops)
+}
+
+// RefreshAll resets the TTL of each of the given keys, a few at a time,
+// as RawRefresh does, e.g. to keep many service registrations alive with
+// a single tick. The returned slice holds the error for each key, in the
+// same order, and nil for every key that was refreshed. Keys which do
+// not exist, e.g. because they expired already, fail with
+// ErrCodeKeyNotFound, and have to be set again.
+func (c *Client) RefreshAll(keys []string, ttl uint64) []error {
+	return forEachKey(keys, func(key string) error {
+		raw, err := c.RawRefresh(key, ttl)
+		if err != nil {
+			return err
+		}
+		_, err = raw.Unmarshal()
+		return err
+	})
+}
+
 func (c *Client) RawUpdateDir(key string, ttl uint64) (*RawResponse, error) {
 	ops := Options{
 		"prevExist": true,
@@ -135,3 +286,45 @@ func (c *Client) RawCreate(key string, value string, ttl uint64) (*RawResponse,
 func (c *Client) RawCreateInOrder(dir string, value string, ttl uint64) (*RawResponse, error) {
 	return c.post(dir, value, ttl)
 }
+
+// CanWrite checks whether a Set of the given key would likely succeed,
+// without writing anything, e.g. to validate a plan of changes first.
+// The key must not be a directory, and the closest of its parents which
+// exists must be a directory, the missing ones being created by the Set.
+// These are read with consistent GETs. If auth is enabled, the roles of
+// the user of the client, or of the guest, must allow to write the key.
+//
+// The check is best-effort: the keys may change before the write, and
+// the roles are only checked if they can be read, which usually needs
+// root access.
+func (c *Client) CanWrite(key string) (bool, error) {
+	key = path.Clean("/" + key)
+
+	for p := key; p != "/"; p = path.Dir(p) {
+		resp, err := c.readWithOptions(p, Options{"consistent": true})
+		if etcdErr, ok := err.(*EtcdError); ok {
+			if etcdErr.ErrorCode == ErrCodeKeyNotFound {
+				continue
+			}
+			// a parent is a file
+			if etcdErr.ErrorCode == ErrCodeNotDir {
+				logger.Debugf("cannot.write %s: %v", key, etcdErr)
+				return false, nil
+			}
+		}
+		if err != nil {
+			return false, err
+		}
+
+		// the key itself must be a file, and its parent a directory
+		if resp.Node.Dir != (p != key) {
+			logger.Debugf("cannot.write %s over %s", key, resp.Node.Key)
+			return false, nil
+		}
+		if p != key {
+			break
+		}
+	}
+
+	return c.allowsWrite(key), nil
+}
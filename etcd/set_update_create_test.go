@@ -1,7 +1,9 @@
 package etcd
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSet(t *testing.T) {
@@ -239,3 +241,385 @@ func TestCreateDir(t *testing.T) {
 			"The response was: %#v", resp.Node.Key, resp)
 	}
 }
+
+func TestQuietSet(t *testing.T) {
+	c := NewClient(nil)
+	c.QuietSet = true
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	c.Delete("foo", true)
+
+	resp, err := c.Set("foo", "bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := resp.Node.ModifiedIndex
+
+	// This should not write anything because the value is unchanged.
+	resp, err = c.Set("foo", "bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "bar" && resp.Node.ModifiedIndex == index) {
+		t.Fatalf("QuietSet 1 should not have bumped the index: %#v", resp)
+	}
+
+	// This should only refresh the TTL.
+	resp, err = c.Set("foo", "bar", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "bar" && resp.Node.TTL == 100) {
+		t.Fatalf("QuietSet 2 failed: %#v", resp)
+	}
+
+	// A watcher started before the refresh must only see the next real change.
+	_, err = c.Set("foo", "bar2", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = c.Watch("foo", index+1, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "bar2" {
+		t.Fatalf("QuietSet 3 woke up the watcher: %#v", resp)
+	}
+}
+
+func TestEnsureKey(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("newKey", true)
+	}()
+
+	c.Delete("newKey", true)
+
+	// This should create the key
+	if err := c.EnsureKey("newKey", "v1", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// This should succeed without touching the existing key
+	if err := c.EnsureKey("newKey", "v2", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Get("newKey", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "v1" {
+		t.Fatalf("EnsureKey should not have replaced the value: %#v", resp)
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	c := NewClient(nil)
+	c.MinTTL = 10
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	// This should raise the TTL to the minimum
+	resp, err := c.Set("foo", "bar", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.TTL != 10 {
+		t.Fatalf("MinTTL 1 failed: %#v", resp.Node)
+	}
+
+	// This should keep the key without TTL
+	resp, err = c.Set("foo", "bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.TTL != 0 {
+		t.Fatalf("MinTTL 2 failed: %#v", resp.Node)
+	}
+
+	// This should be rejected
+	c.RejectShortTTL = true
+	resp, err = c.Set("foo", "bar", 1)
+	if err == nil {
+		t.Fatalf("MinTTL 3 should have rejected the TTL: %#v", resp)
+	}
+
+	resp, err = c.Set("foo", "bar", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.TTL != 10 {
+		t.Fatalf("MinTTL 4 failed: %#v", resp.Node)
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	large := strings.Repeat("x", defaultMaxValueBytes+1)
+	if _, err := c.Set("foo", large, 5); err != ErrValueTooLarge {
+		t.Fatalf("Set should reject the value client-side: %v", err)
+	}
+	if _, err := c.CreateInOrder("fooDir", large, 5); err != ErrValueTooLarge {
+		t.Fatalf("CreateInOrder should reject the value client-side: %v", err)
+	}
+
+	c.MaxValueBytes = 3
+	if _, err := c.Set("foo", "bar", 5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set("foo", "barbaz", 5); err != ErrValueTooLarge {
+		t.Fatalf("Set should reject a value above MaxValueBytes: %v", err)
+	}
+
+	resp, err := c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "bar" {
+		t.Fatalf("the rejected value should not have been sent: %q", resp.Node.Value)
+	}
+}
+
+func TestSetSpecialCharacters(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	for _, value := range []string{"a+b=c\n", "100%", "a b&c=d", "%2B+", "\t\"\\"} {
+		resp, err := c.Set("foo", value, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Node.Value != value {
+			t.Fatalf("Set returned %q, expected %q", resp.Node.Value, value)
+		}
+
+		resp, err = c.Get("foo", false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Node.Value != value {
+			t.Fatalf("Get returned %q, expected %q", resp.Node.Value, value)
+		}
+	}
+}
+
+func TestRefreshAll(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("refresh_foo", true)
+	}()
+
+	c.Delete("refresh_foo", true)
+
+	keys := []string{"refresh_foo/a", "refresh_foo/b", "refresh_foo/c", "refresh_foo/missing"}
+	expirations := make(map[string]time.Time)
+	for _, key := range keys[:3] {
+		resp, err := c.Set(key, "value of "+key, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expirations[key] = *resp.Node.Expiration
+	}
+
+	errs := c.RefreshAll(keys, 100)
+	if len(errs) != len(keys) {
+		t.Fatalf("RefreshAll returned %v errors for %v keys", len(errs), len(keys))
+	}
+	for i, key := range keys[:3] {
+		if errs[i] != nil {
+			t.Fatalf("RefreshAll failed for %v: %v", key, errs[i])
+		}
+
+		resp, err := c.Get(key, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Node.Value != "value of "+key {
+			t.Fatalf("RefreshAll changed the value of %v: %v", key, resp.Node.Value)
+		}
+		if !resp.Node.Expiration.After(expirations[key]) || resp.Node.TTL <= 5 {
+			t.Fatalf("RefreshAll did not extend the TTL of %v: %#v", key, resp.Node)
+		}
+	}
+
+	if etcdErr, ok := errs[3].(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+		t.Fatalf("RefreshAll should fail for a missing key: %v", errs[3])
+	}
+}
+
+func TestCreateEphemeralSeq(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("ephemeral_foo", true)
+	}()
+
+	c.Delete("ephemeral_foo", true)
+
+	var keys []string
+	for _, value := range []string{"first", "second"} {
+		key, resp, err := c.CreateEphemeralSeq("ephemeral_foo", value, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(key == resp.Node.Key && resp.Node.Value == value && resp.Node.TTL > 0 && resp.Node.TTL <= 5) {
+			t.Fatalf("CreateEphemeralSeq failed: %v %#v", key, resp.Node)
+		}
+		if !strings.HasPrefix(key, "/ephemeral_foo/") {
+			t.Fatalf("%v is not under the directory", key)
+		}
+		keys = append(keys, key)
+	}
+
+	// The names are ordered, as well as the keys when listed sorted
+	if len(keys[0]) > len(keys[1]) || (len(keys[0]) == len(keys[1]) && keys[0] >= keys[1]) {
+		t.Fatalf("the keys are not ordered: %q", keys)
+	}
+	resp, err := c.Get("ephemeral_foo", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(len(resp.Node.Nodes) == 2 && resp.Node.Nodes[0].Key == keys[0] && resp.Node.Nodes[1].Key == keys[1]) {
+		t.Fatalf("unexpected listing: %#v", resp.Node.Nodes)
+	}
+
+	if _, _, err := c.CreateEphemeralSeq("ephemeral_foo", "forever", 0); err == nil {
+		t.Fatal("CreateEphemeralSeq should fail without a TTL")
+	}
+}
+
+func TestSetEmptyValue(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("empty_foo", true)
+	}()
+
+	c.Delete("empty_foo", true)
+
+	if _, err := c.Set("empty_foo", "bar", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Set("empty_foo", "", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Value == "" && !resp.Node.Dir && resp.PrevNode.Value == "bar") {
+		t.Fatalf("Set failed: %#v", resp)
+	}
+
+	resp, err = c.Get("empty_foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Kind() == FileNode && resp.Node.Value == "") {
+		t.Fatalf("the key should hold an empty value: %#v", resp.Node)
+	}
+
+	// A refresh leaves the empty value alone, and directories get none
+	if _, err := c.RawRefresh("empty_foo", 10); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = c.CreateDir("empty_foo_dir", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Delete("empty_foo_dir", true)
+	if resp.Node.Kind() != DirNode {
+		t.Fatalf("CreateDir should create a directory: %#v", resp.Node)
+	}
+}
+
+func TestCanWrite(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("canwrite_foo", true)
+	}()
+
+	c.Delete("canwrite_foo", true)
+	c.Set("canwrite_foo/leaf", "bar", 5)
+	c.CreateDir("canwrite_foo/dir", 5)
+
+	tests := []struct {
+		key      string
+		expected bool
+	}{
+		{"canwrite_foo/leaf", true},
+		{"canwrite_foo/new", true},
+		{"canwrite_foo/missing/deep/new", true},
+		{"canwrite_foo/leaf/child", false},
+		{"canwrite_foo/leaf/missing/child", false},
+		{"canwrite_foo/dir", false},
+		{"canwrite_foo/dir/new", true},
+	}
+
+	for _, test := range tests {
+		ok, err := c.CanWrite(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != test.expected {
+			t.Errorf("CanWrite(%q) = %v, expected %v", test.key, ok, test.expected)
+		}
+	}
+
+	// Nothing was written
+	resp, err := c.Get("canwrite_foo", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.CountLeaves() != 2 {
+		t.Fatalf("CanWrite should not write anything: %#v", resp.Node.Nodes)
+	}
+}
+
+func TestReserveSlot(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("slot_foo", true)
+	}()
+
+	c.Delete("slot_foo", true)
+	c.Set("slot_foo/0", "a", 5)
+	c.Set("slot_foo/1", "b", 5)
+
+	n, err := c.ReserveSlot("slot_foo", 0, 3, "c", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("ReserveSlot reserved slot %v, expected 2", n)
+	}
+
+	resp, err := c.Get("slot_foo/2", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "c" {
+		t.Fatalf("slot 2 holds %v, expected c", resp.Node.Value)
+	}
+
+	if _, err := c.ReserveSlot("slot_foo", 0, 3, "d", 5); err != ErrNoSlots {
+		t.Fatalf("ReserveSlot of a full pool returned %v, expected ErrNoSlots", err)
+	}
+
+	// a slot given up is reused
+	c.Delete("slot_foo/1", false)
+	n, err = c.ReserveSlot("slot_foo", 0, 3, "d", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("ReserveSlot reserved slot %v, expected the freed slot 1", n)
+	}
+}
@@ -0,0 +1,368 @@
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LeaderStats are the statistics the leader keeps about its followers,
+// as served under /v2/stats/leader.
+type LeaderStats struct {
+	Leader    string                    `json:"leader"`
+	Followers map[string]*FollowerStats `json:"followers"`
+}
+
+type FollowerStats struct {
+	Latency LatencyStats `json:"latency"`
+	Counts  CountsStats  `json:"counts"`
+}
+
+// LatencyStats are in milliseconds.
+type LatencyStats struct {
+	Current           float64 `json:"current"`
+	Average           float64 `json:"average"`
+	StandardDeviation float64 `json:"standardDeviation"`
+	Minimum           float64 `json:"minimum"`
+	Maximum           float64 `json:"maximum"`
+}
+
+type CountsStats struct {
+	Fail    uint64 `json:"fail"`
+	Success uint64 `json:"success"`
+}
+
+// SelfStats are the statistics a machine keeps about itself,
+// as served under /v2/stats/self.
+type SelfStats struct {
+	Name      string    `json:"name"`
+	ID        string    `json:"id"`
+	State     string    `json:"state"`
+	StartTime time.Time `json:"startTime"`
+
+	LeaderInfo struct {
+		// Leader is the ID of the leader
+		Leader    string    `json:"leader"`
+		Uptime    string    `json:"uptime"`
+		StartTime time.Time `json:"startTime"`
+	} `json:"leaderInfo"`
+
+	RecvAppendRequestCnt uint64  `json:"recvAppendRequestCnt"`
+	RecvingPkgRate       float64 `json:"recvPkgRate,omitempty"`
+	RecvingBandwidthRate float64 `json:"recvBandwidthRate,omitempty"`
+
+	SendAppendRequestCnt uint64  `json:"sendAppendRequestCnt"`
+	SendingPkgRate       float64 `json:"sendPkgRate,omitempty"`
+	SendingBandwidthRate float64 `json:"sendBandwidthRate,omitempty"`
+}
+
+// StoreStats are the counters of the key space operations a machine
+// has served, as served under /v2/stats/store.
+type StoreStats struct {
+	GetSuccess uint64 `json:"getsSuccess"`
+	GetFail    uint64 `json:"getsFail"`
+
+	SetSuccess uint64 `json:"setsSuccess"`
+	SetFail    uint64 `json:"setsFail"`
+
+	DeleteSuccess uint64 `json:"deleteSuccess"`
+	DeleteFail    uint64 `json:"deleteFail"`
+
+	UpdateSuccess uint64 `json:"updateSuccess"`
+	UpdateFail    uint64 `json:"updateFail"`
+
+	CreateSuccess uint64 `json:"createSuccess"`
+	CreateFail    uint64 `json:"createFail"`
+
+	CompareAndSwapSuccess uint64 `json:"compareAndSwapSuccess"`
+	CompareAndSwapFail    uint64 `json:"compareAndSwapFail"`
+
+	CompareAndDeleteSuccess uint64 `json:"compareAndDeleteSuccess"`
+	CompareAndDeleteFail    uint64 `json:"compareAndDeleteFail"`
+
+	ExpireCount uint64 `json:"expireCount"`
+	Watchers    uint64 `json:"watchers"`
+}
+
+// GetSelfStats returns the statistics of the machine serving the request.
+func (c *Client) GetSelfStats() (*SelfStats, error) {
+	return c.getSelfStats(nil)
+}
+
+// getSelfStats is GetSelfStats, cancelled when cancel is closed.
+func (c *Client) getSelfStats(cancel <-chan bool) (*SelfStats, error) {
+	raw, err := c.getStats("self", cancel)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := new(SelfStats)
+	if err := raw.unmarshalStats(stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// LeaderUptime returns for how long the current leader has been leading,
+// as seen by the machine serving the request.
+//
+// etcd does not count elections; a short uptime, or a LeaderInfo.StartTime
+// that changes between calls of GetSelfStats, shows that the leadership
+// changed in the meantime.
+func (c *Client) LeaderUptime() (time.Duration, error) {
+	stats, err := c.GetSelfStats()
+	if err != nil {
+		return 0, err
+	}
+
+	// etcd formats the uptime as a time.Duration
+	return time.ParseDuration(stats.LeaderInfo.Uptime)
+}
+
+// LeaderSummary is the part of the statistics of the leader attached to
+// the responses to writes, see Client.AttachLeaderStats.
+type LeaderSummary struct {
+	// Uptime is for how long the leader has been leading.
+	Uptime time.Duration
+	// Followers is the number of followers of the leader.
+	Followers int
+}
+
+// leaderSummary fetches the statistics of the leader for a LeaderSummary.
+func (c *Client) leaderSummary() (*LeaderSummary, error) {
+	uptime, err := c.LeaderUptime()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := c.GetLeaderStats()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaderSummary{Uptime: uptime, Followers: len(stats.Followers)}, nil
+}
+
+// GetLeaderStats returns the statistics of the leader.
+func (c *Client) GetLeaderStats() (*LeaderStats, error) {
+	raw, err := c.getStats("leader", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := new(LeaderStats)
+	if err := raw.unmarshalStats(stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// StoreMetrics returns the store statistics of the machine serving the
+// request.
+//
+// The v2 store cannot be compacted on demand: etcd cleans up expired
+// keys on its own and only keeps a bounded window of events for watches.
+// The closest thing it exposes are these counters, of which ExpireCount
+// tracks the cleanup of expired keys and Watchers the number of watches
+// holding on to the event history.
+func (c *Client) StoreMetrics() (*StoreStats, error) {
+	raw, err := c.getStats("store", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := new(StoreStats)
+	if err := raw.unmarshalStats(stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// ClusterKeyStats returns the store statistics of every member of the
+// cluster, keyed by member ID, so that a member with diverging counters
+// stands out. The members are queried concurrently, trying each of their
+// client URLs in turn. If some members cannot be reached, the statistics
+// of the others are returned along with an error naming them.
+func (c *Client) ClusterKeyStats() (map[string]StoreStats, error) {
+	members, err := c.GetMembers()
+	if err != nil {
+		return nil, err
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	stats := make(map[string]StoreStats)
+	var failed []string
+
+	for _, member := range members {
+		wg.Add(1)
+		go func(member Member) {
+			defer wg.Done()
+
+			memberStats := StoreStats{}
+			err := c.getMemberStats(member, "store", &memberStats)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				logger.Debugf("store.stats %s failed: %v", member.ID, err)
+				failed = append(failed, member.ID)
+				return
+			}
+			stats[member.ID] = memberStats
+		}(member)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return stats, fmt.Errorf("Cannot get the store statistics of %v",
+			strings.Join(failed, ", "))
+	}
+	return stats, nil
+}
+
+// getMemberStats gets the given statistics from the member itself,
+// rather than from the leader, trying each of its client URLs in turn.
+func (c *Client) getMemberStats(member Member, name string, v interface{}) error {
+	err := fmt.Errorf("Member %v has no client URLs", member.ID)
+	for _, clientURL := range c.memberURLs(member) {
+		var resp *http.Response
+		resp, err = c.getURL(c.httpClient, clientURL, c.createHttpPath(clientURL, path.Join(version, "stats", name)))
+		if err != nil {
+			continue
+		}
+
+		raw := &RawResponse{StatusCode: resp.StatusCode, Header: resp.Header}
+		raw.Body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			continue
+		}
+
+		if err = raw.unmarshalStats(v); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// quorumSampleInterval is the time between the two samples of the leader
+// statistics taken by HasQuorum, two heartbeats at etcd's default.
+var quorumSampleInterval = 200 * time.Millisecond
+
+// quorumCacheTTL is how long the writes trust a quorum found by
+// RequireQuorum before checking again.
+var quorumCacheTTL = time.Second
+
+// HasQuorum reports whether the leader reaches a majority of the members
+// of the cluster, counting the leader itself and every follower the
+// leader currently replicates to. The success and failure counts of the
+// followers only ever grow, so the leader statistics are read twice,
+// quorumSampleInterval apart: a follower which was never replicated to,
+// or whose failures grew without any success in between, is not
+// reachable. If the machine the client believes to be the leader is not
+// one, the leader is looked up again with Ping; if the cluster has no
+// leader, there is no quorum.
+func (c *Client) HasQuorum() (bool, error) {
+	return c.hasQuorum(nil)
+}
+
+// hasQuorum is HasQuorum, giving up with ErrRequestCancelled once the
+// cancel channel is closed.
+func (c *Client) hasQuorum(cancel <-chan bool) (bool, error) {
+	before, err := c.sampleLeaderStats(cancel)
+	if before == nil || err != nil {
+		return false, err
+	}
+
+	// a single machine is a majority on its own
+	if len(before.Followers) == 0 {
+		return true, nil
+	}
+
+	select {
+	case <-time.After(quorumSampleInterval):
+	case <-cancel:
+		return false, ErrRequestCancelled
+	}
+	after, err := c.sampleLeaderStats(cancel)
+	if after == nil || err != nil {
+		return false, err
+	}
+
+	reachable := 1
+	for name, follower := range after.Followers {
+		counts := follower.Counts
+		prev := CountsStats{}
+		if f, ok := before.Followers[name]; ok {
+			prev = f.Counts
+		}
+
+		failing := counts.Fail > prev.Fail && counts.Success == prev.Success
+		if counts.Success > 0 && !failing {
+			reachable++
+		}
+	}
+
+	return reachable > (len(after.Followers)+1)/2, nil
+}
+
+// sampleLeaderStats gets the leader statistics for HasQuorum, or nil if
+// the cluster has no leader the client can find.
+func (c *Client) sampleLeaderStats(cancel <-chan bool) (*LeaderStats, error) {
+	raw, err := c.getStats("leader", cancel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the leader serves leader statistics; the client may simply
+	// not have seen the leadership move yet
+	if raw.StatusCode == http.StatusForbidden {
+		leader, err := c.Ping()
+		if err != nil {
+			logger.Debug("quorum.leader.lookup failed: ", err)
+			return nil, nil
+		}
+		c.cluster.updateLeader(leader)
+
+		raw, err = c.getStats("leader", cancel)
+		if err != nil {
+			return nil, err
+		}
+		if raw.StatusCode == http.StatusForbidden {
+			return nil, nil
+		}
+	}
+
+	stats := new(LeaderStats)
+	if err := raw.unmarshalStats(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// getStats issues a GET request for the given statistics
+func (c *Client) getStats(name string, cancel <-chan bool) (*RawResponse, error) {
+	logger.Debugf("stats %s [%s]", name, c.cluster.Leader)
+
+	req := NewRawRequest("GET", path.Join("stats", name), nil, cancel)
+	return c.SendRequest(req)
+}
+
+// unmarshalStats parses a RawResponse holding statistics into v
+func (rr *RawResponse) unmarshalStats(v interface{}) error {
+	if rr.StatusCode != http.StatusOK {
+		return handleError(rr.Body)
+	}
+
+	return json.Unmarshal(rr.Body, v)
+}
@@ -0,0 +1,434 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newStatsServer returns a server answering every request with
+// the given status code and body.
+func newStatsServer(code int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestHasQuorum(t *testing.T) {
+	c := NewClient(nil)
+
+	// A single machine is always a majority on its own
+	hasQuorum, err := c.HasQuorum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasQuorum {
+		t.Fatal("a single machine cluster should have a quorum")
+	}
+
+	ts := newStatsServer(http.StatusOK, `{"leader":"a","followers":{
+		"b":{"counts":{"fail":0,"success":10}},
+		"c":{"counts":{"fail":10,"success":0}},
+		"d":{"counts":{"fail":10,"success":0}},
+		"e":{"counts":{"fail":10,"success":0}}}}`)
+	defer ts.Close()
+
+	c = NewClient([]string{ts.URL, "http://b:4001", "http://c:4001",
+		"http://d:4001", "http://e:4001"})
+
+	hasQuorum, err = c.HasQuorum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasQuorum {
+		t.Fatal("two out of five machines should not be a quorum")
+	}
+
+	noLeader := newStatsServer(http.StatusForbidden, `{"message":"not current leader"}`)
+	defer noLeader.Close()
+
+	c = NewClient([]string{noLeader.URL})
+
+	hasQuorum, err = c.HasQuorum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasQuorum {
+		t.Fatal("a cluster without leader should not have a quorum")
+	}
+}
+
+// newSampledStatsServer returns a server answering the requests for the
+// leader statistics with the given bodies in turn, repeating the last one.
+func newSampledStatsServer(samples ...string) *httptest.Server {
+	n := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/stats/leader" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, samples[n])
+		if n < len(samples)-1 {
+			n++
+		}
+	}))
+}
+
+func TestHasQuorumFailingFollowers(t *testing.T) {
+	quorumSampleInterval = time.Millisecond
+	defer func() {
+		quorumSampleInterval = 200 * time.Millisecond
+	}()
+
+	healthy := `{"leader":"a","followers":{
+		"b":{"counts":{"fail":0,"success":10}},
+		"c":{"counts":{"fail":0,"success":10}}}}`
+
+	// b was replicated to, but has only been failing since
+	ts := newSampledStatsServer(healthy, `{"leader":"a","followers":{
+		"b":{"counts":{"fail":5,"success":10}},
+		"c":{"counts":{"fail":0,"success":12}}}}`)
+	defer ts.Close()
+
+	// the client only knows of the leader, not of the size of the cluster
+	c := NewClient([]string{ts.URL})
+
+	hasQuorum, err := c.HasQuorum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasQuorum {
+		t.Fatal("the leader and c should be a quorum of three")
+	}
+
+	ts = newSampledStatsServer(healthy, `{"leader":"a","followers":{
+		"b":{"counts":{"fail":5,"success":10}},
+		"c":{"counts":{"fail":3,"success":10}}}}`)
+	defer ts.Close()
+
+	c = NewClient([]string{ts.URL})
+
+	hasQuorum, err = c.HasQuorum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasQuorum {
+		t.Fatal("a leader cut off from both of its followers should not have a quorum")
+	}
+}
+
+func TestStoreMetrics(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("foo", true)
+	}()
+
+	before, err := c.StoreMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("foo", "bar", 5)
+
+	after, err := c.StoreMetrics()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after.SetSuccess != before.SetSuccess+1 {
+		t.Fatalf("StoreMetrics should count the set: %v, %v",
+			before.SetSuccess, after.SetSuccess)
+	}
+}
+
+func TestClusterKeyStats(t *testing.T) {
+	a := newStatsServer(http.StatusOK, `{"setsSuccess":10,"getsSuccess":3}`)
+	defer a.Close()
+	b := newStatsServer(http.StatusOK, `{"setsSuccess":7,"getsSuccess":5}`)
+	defer b.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"members":[
+			{"id":"a","name":"a","clientURLs":["%s"]},
+			{"id":"b","name":"b","clientURLs":["%s"]}]}`, a.URL, b.URL)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	stats, err := c.ClusterKeyStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]StoreStats{
+		"a": StoreStats{SetSuccess: 10, GetSuccess: 3},
+		"b": StoreStats{SetSuccess: 7, GetSuccess: 5},
+	}
+	if !reflect.DeepEqual(stats, expected) {
+		t.Fatalf("ClusterKeyStats failed: %#v", stats)
+	}
+}
+
+func TestLeaderUptime(t *testing.T) {
+	ts := newStatsServer(http.StatusOK, `{"name":"a","id":"1","state":"StateFollower",
+		"leaderInfo":{"leader":"2","uptime":"1h10m59.322358947s","startTime":"2015-01-01T00:00:00Z"}}`)
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	uptime, err := c.LeaderUptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime != time.Hour+10*time.Minute+59322358947*time.Nanosecond {
+		t.Fatalf("LeaderUptime failed: %v", uptime)
+	}
+
+	// The live machine leads itself
+	uptime, err = NewClient(nil).LeaderUptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime <= 0 {
+		t.Fatalf("LeaderUptime of the live machine failed: %v", uptime)
+	}
+}
+
+func TestRequireQuorum(t *testing.T) {
+	quorumSampleInterval = time.Millisecond
+	defer func() {
+		quorumSampleInterval = 200 * time.Millisecond
+	}()
+
+	stats := `{"leader":"a","followers":{
+		"b":{"counts":{"fail":10,"success":0}},
+		"c":{"counts":{"fail":10,"success":0}}}}`
+
+	writes := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/stats/leader" {
+			fmt.Fprint(w, stats)
+			return
+		}
+		writes++
+		w.Header().Set("X-Etcd-Index", "1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"action":"set","node":{"key":"/foo","value":"bar"}}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL, "http://b:4001", "http://c:4001"})
+	c.RequireQuorum = true
+
+	// The leader alone is a minority of three
+	if _, err := c.Set("foo", "bar", 0); err != ErrNoQuorum {
+		t.Fatalf("Set without quorum returned %v, expected ErrNoQuorum", err)
+	}
+	if writes != 0 {
+		t.Fatalf("Set without quorum reached the server %v times", writes)
+	}
+
+	// Reads are not checked
+	if _, err := c.GetLeaderStats(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats = `{"leader":"a","followers":{
+		"b":{"counts":{"fail":0,"success":10}},
+		"c":{"counts":{"fail":10,"success":0}}}}`
+
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 1 {
+		t.Fatalf("Set with quorum reached the server %v times, expected once", writes)
+	}
+}
+
+func TestRequireQuorumFailingFollowers(t *testing.T) {
+	quorumSampleInterval = time.Millisecond
+	defer func() {
+		quorumSampleInterval = 200 * time.Millisecond
+	}()
+
+	// The leader was healthy, then got cut off from both followers
+	samples := []string{
+		`{"leader":"a","followers":{
+			"b":{"counts":{"fail":0,"success":10}},
+			"c":{"counts":{"fail":0,"success":10}}}}`,
+		`{"leader":"a","followers":{
+			"b":{"counts":{"fail":4,"success":10}},
+			"c":{"counts":{"fail":4,"success":10}}}}`,
+	}
+
+	writes := 0
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/stats/leader" {
+			fmt.Fprint(w, samples[n%2])
+			n++
+			return
+		}
+		writes++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"action":"set","node":{"key":"/foo","value":"bar"}}`)
+	}))
+	defer ts.Close()
+
+	// A single endpoint of the three member cluster
+	c := NewClient([]string{ts.URL})
+	c.RequireQuorum = true
+
+	if _, err := c.Set("foo", "bar", 0); err != ErrNoQuorum {
+		t.Fatalf("Set through a cut off leader returned %v, expected ErrNoQuorum", err)
+	}
+	if writes != 0 {
+		t.Fatalf("Set without quorum reached the server %v times", writes)
+	}
+}
+
+func TestRequireQuorumStaleLeader(t *testing.T) {
+	quorumSampleInterval = time.Millisecond
+	defer func() {
+		quorumSampleInterval = 200 * time.Millisecond
+	}()
+
+	// The new leader reaches its only follower
+	writes := 0
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/stats/leader" {
+			fmt.Fprint(w, `{"leader":"2","followers":{"1":{"counts":{"fail":0,"success":10}}}}`)
+			return
+		}
+		writes++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"action":"set","node":{"key":"/foo","value":"bar"}}`)
+	}))
+	defer leader.Close()
+
+	// The old leader knows it lost the leadership
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/stats/leader":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message":"not current leader"}`)
+		case "/v2/stats/self":
+			fmt.Fprint(w, `{"name":"a","id":"1","state":"StateFollower","leaderInfo":{"leader":"2"}}`)
+		case "/v2/members":
+			fmt.Fprintf(w, `{"members":[{"id":"2","name":"b","clientURLs":["%v"]}]}`, leader.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer old.Close()
+
+	c := NewClient([]string{old.URL, leader.URL})
+	c.RequireQuorum = true
+
+	if _, err := c.Set("foo", "bar", 0); err != nil {
+		t.Fatalf("Set through the stale leader failed: %v", err)
+	}
+	if !(writes == 1 && c.cluster.Leader == leader.URL) {
+		t.Fatalf("Set reached the new leader %v times, leader is %v", writes, c.cluster.Leader)
+	}
+}
+
+func TestRequireQuorumCached(t *testing.T) {
+	quorumSampleInterval = time.Minute
+	defer func() {
+		quorumSampleInterval = 200 * time.Millisecond
+	}()
+
+	samples := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/stats/leader" {
+			samples++
+			fmt.Fprint(w, `{"leader":"a","followers":{"b":{"counts":{"fail":0,"success":10}}}}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"action":"set","node":{"key":"/foo","value":"bar"}}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.RequireQuorum = true
+
+	// The wait between the samples is cut short by the cancel channel
+	cancel := make(chan bool)
+	time.AfterFunc(10*time.Millisecond, func() {
+		close(cancel)
+	})
+	rr := NewRawRequest("PUT", keyToPath("foo"), buildValues("bar", 0, true), cancel)
+	if _, err := c.SendRequest(rr); err != ErrRequestCancelled {
+		t.Fatalf("the cancelled write returned %v, expected ErrRequestCancelled", err)
+	}
+
+	// A quorum found is trusted by the writes which follow
+	quorumSampleInterval = time.Millisecond
+	for i := 0; i < 3; i++ {
+		if _, err := c.Set("foo", "bar", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if samples != 3 {
+		t.Fatalf("the quorum was sampled %v times, expected 1 + 2", samples)
+	}
+}
+
+func TestAttachLeaderStats(t *testing.T) {
+	statsRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Etcd-Index", "1")
+		switch r.URL.Path {
+		case "/v2/stats/self":
+			statsRequests++
+			fmt.Fprint(w, `{"name":"a","id":"a","state":"StateLeader",
+				"leaderInfo":{"leader":"a","uptime":"1m30s"}}`)
+		case "/v2/stats/leader":
+			statsRequests++
+			fmt.Fprint(w, `{"leader":"a","followers":{
+				"b":{"counts":{"fail":0,"success":10}},
+				"c":{"counts":{"fail":0,"success":10}}}}`)
+		default:
+			fmt.Fprint(w, `{"action":"set","node":{"key":"/foo","value":"bar"}}`)
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	resp, err := c.Set("foo", "bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.LeaderStats != nil || statsRequests != 0 {
+		t.Fatalf("the leader statistics should not be fetched by default: %v", resp.LeaderStats)
+	}
+
+	c.AttachLeaderStats = true
+
+	resp, err = c.Set("foo", "bar", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &LeaderSummary{Uptime: 90 * time.Second, Followers: 2}
+	if !reflect.DeepEqual(resp.LeaderStats, expected) {
+		t.Fatalf("Set attached %#v, expected %#v", resp.LeaderStats, expected)
+	}
+
+	// reads go without
+	statsRequests = 0
+	resp, err = c.Get("foo", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.LeaderStats != nil || statsRequests != 0 {
+		t.Fatalf("the leader statistics should only be attached to writes: %v", resp.LeaderStats)
+	}
+}
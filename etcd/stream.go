@@ -0,0 +1,262 @@
+package etcd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StreamTree gets every key under the given prefix, recursively, and
+// sends them one by one on the returned node channel, which is closed
+// once the whole tree was read. Directories are not sent.
+//
+// Unlike a recursive Get, the response is decoded while it is received,
+// so that only the nodes on the path to the current key are kept in
+// memory, however large the tree is. The keys arrive in sorted order.
+//
+// The error channel receives at most one error, after the node channel
+// was closed, and is closed in turn. The node channel must be drained.
+func (c *Client) StreamTree(prefix string) (chan *Node, chan error) {
+	nodes := make(chan *Node, defaultBufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		err := c.streamTree(prefix, func(n *Node) error {
+			if !n.Dir {
+				nodes <- n
+			}
+			return nil
+		})
+		close(nodes)
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return nodes, errs
+}
+
+// errFound stops the stream of FindFirst.
+var errFound = errors.New("found")
+
+// FindFirst returns the first key under the given prefix, in sorted
+// order, for which pred returns true, or nil if there is none. The tree
+// is streamed as by StreamTree, and the stream is stopped at the match,
+// so that the rest of the tree is neither received nor decoded.
+func (c *Client) FindFirst(prefix string, pred func(n *Node) bool) (*Node, error) {
+	var found *Node
+	err := c.streamTree(prefix, func(n *Node) error {
+		if !n.Dir && pred(n) {
+			found = n
+			return errFound
+		}
+		return nil
+	})
+	if err != nil && err != errFound {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// streamTree issues a recursive GET and hands the keys and the empty
+// directories to emit while decoding the response. Decoding stops at
+// the first error returned by emit. Until decoding starts, a machine
+// which cannot be reached is given up for the next one, backing off in
+// between, until CheckRetry gives up.
+func (c *Client) streamTree(prefix string, emit func(*Node) error) error {
+	logger.Debugf("streamTree %s [%s]", prefix, c.cluster.Leader)
+	if err := c.checkKey(prefix); err != nil {
+		return err
+	}
+
+	options := Options{
+		"recursive": true,
+		"sorted":    true,
+	}
+	if c.config.Consistency == STRONG_CONSISTENCY {
+		options["consistent"] = true
+	}
+
+	str, err := options.toParameters(VALID_GET_OPTIONS)
+	if err != nil {
+		return err
+	}
+	p := keyToPath(prefix) + str
+
+	checkRetry := c.retryPolicy()
+	backoff := c.newBackoff()
+	numReqs := 1
+
+	// follow the redirects to the leader, if any
+	redirects := 0
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff.next())
+		}
+
+		var machine string
+		if c.config.Consistency == WEAK_CONSISTENCY {
+			machine = c.cluster.pickMachine()
+		} else {
+			machine = c.cluster.Leader
+		}
+
+		req, err := http.NewRequest("GET", c.getHttpPath(machine, p), nil)
+		if err != nil {
+			return err
+		}
+		setCredentials(req, machine)
+
+		resp, err := c.do(req)
+		numReqs++
+		if err != nil {
+			logger.Debug("stream.tree network error: ", err)
+			if checkErr := checkRetry(c.cluster, numReqs, http.Response{}, err); checkErr != nil {
+				return checkErr
+			}
+			c.cluster.switchLeader(attempt % len(c.cluster.Machines))
+			continue
+		}
+
+		if c.isRedirect(resp.StatusCode) && redirects < len(c.cluster.Machines) {
+			redirects++
+			u, err := resp.Location()
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+			c.cluster.updateLeaderFromURL(u)
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+			return handleError(b)
+		}
+
+		return decodeTree(json.NewDecoder(resp.Body), c.FieldAliases, emit)
+	}
+}
+
+// decodeTree decodes a response, handing the keys and empty directories
+// of its node to emit. The fields are renamed according to aliases, see
+// Client.FieldAliases.
+func decodeTree(dec *json.Decoder, aliases map[string]string, emit func(*Node) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if strings.EqualFold(fieldName(tok, aliases), "node") {
+			if err := decodeNode(dec, aliases, emit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var skipped json.RawMessage
+		if err := dec.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// decodeNode decodes a node, handing it to emit if it is a key or an
+// empty directory, or decoding its children in turn otherwise.
+func decodeNode(dec *json.Decoder, aliases map[string]string, emit func(*Node) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	children := 0
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		name := fieldName(tok, aliases)
+		if strings.EqualFold(name, "nodes") {
+			if err := expectDelim(dec, '['); err != nil {
+				return err
+			}
+			for ; dec.More(); children++ {
+				if err := decodeNode(dec, aliases, emit); err != nil {
+					return err
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		fields[name] = value
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return err
+	}
+
+	if children > 0 {
+		return nil
+	}
+
+	// the fields of a key are few, so simply decode them again
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	n := new(Node)
+	if err := json.Unmarshal(b, n); err != nil {
+		return err
+	}
+
+	return emit(n)
+}
+
+// fieldName returns the canonical name of the field named by tok.
+func fieldName(tok json.Token, aliases map[string]string) string {
+	name := fmt.Sprint(tok)
+	if alias, ok := aliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// expectDelim reads the next token and makes sure it is the given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if tok != delim {
+		return fmt.Errorf("Unexpected %v in response, expected %v", tok, delim)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamTree(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("fooDir", true)
+	}()
+
+	c.Set("fooDir/k0", "v0", 5)
+	c.Set("fooDir/childDir/k1", "v1", 5)
+	c.SetDir("fooDir/emptyDir", 5)
+
+	nodes, errs := c.StreamTree("fooDir")
+
+	var keys []string
+	for n := range nodes {
+		keys = append(keys, n.Key+"="+n.Value)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(keys) != "[/fooDir/childDir/k1=v1 /fooDir/k0=v0]" {
+		t.Fatalf("StreamTree failed: %v", keys)
+	}
+
+	_, errs = c.StreamTree("nonexistent")
+	if err := <-errs; err == nil {
+		t.Fatal("should not be able to stream a non-exist key")
+	}
+}
+
+func TestStreamTreeFailover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"action":"get","node":{"key":"/fooDir","dir":true,"nodes":[{"key":"/fooDir/k0","value":"v0"}]}}`)
+	}))
+	defer ts.Close()
+
+	// The first leader is down
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	c := NewClient([]string{down.URL, ts.URL})
+	c.RetryBackoff = time.Millisecond
+
+	node, err := c.FindFirst("fooDir", func(n *Node) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node == nil || node.Key != "/fooDir/k0" {
+		t.Fatalf("FindFirst failed over to %v", node)
+	}
+
+	// Nobody can be reached
+	ts.Close()
+	if _, err := c.FindFirst("fooDir", func(n *Node) bool { return true }); err == nil {
+		t.Fatal("FindFirst should fail when no machine is reachable")
+	}
+}
+
+func TestStreamTreeLarge(t *testing.T) {
+	const total = 100000
+	firstReceived := make(chan bool)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"action":"get","node":{"key":"/big","dir":true,"nodes":[`)
+		for i := 0; i < total; i++ {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"key":"/big/dir%v","dir":true,"nodes":[{"key":"/big/dir%v/k","value":"%v","modifiedIndex":%v}]}`,
+				i, i, i, i+1)
+
+			// Hold the rest of the response back until the first node
+			// arrived, which can only happen if it is streamed
+			if i == 100 {
+				w.(http.Flusher).Flush()
+				select {
+				case <-firstReceived:
+				case <-time.After(5 * time.Second):
+					return
+				}
+			}
+		}
+		fmt.Fprint(w, `]}}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	nodes, errs := c.StreamTree("big")
+
+	count := 0
+	for n := range nodes {
+		if count == 0 {
+			close(firstReceived)
+		}
+		if n.Value != fmt.Sprint(count) || n.ModifiedIndex != uint64(count+1) {
+			t.Fatalf("unexpected node %v: %#v", count, n)
+		}
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if count != total {
+		t.Fatalf("StreamTree returned %v nodes, expected %v", count, total)
+	}
+}
+
+func TestFindFirst(t *testing.T) {
+	const total = 100000
+	stopped := make(chan bool)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"action":"get","node":{"key":"/big","dir":true,"nodes":[`)
+		for i := 0; i < total; i++ {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"key":"/big/k%06d","value":"%v","modifiedIndex":%v}`, i, i, i+1)
+
+			// Hold the rest of the response back until the client
+			// hung up, which it only does if it stops at the match
+			if i == 100 {
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					close(stopped)
+					return
+				case <-time.After(5 * time.Second):
+				}
+			}
+		}
+		fmt.Fprint(w, `]}}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	n, err := c.FindFirst("big", func(n *Node) bool {
+		return n.ModifiedIndex > 10 && n.ModifiedIndex%10 == 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == nil || n.Key != "/big/k000019" {
+		t.Fatalf("FindFirst returned %#v, expected /big/k000019", n)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("FindFirst did not stop the stream at the match")
+	}
+}
@@ -0,0 +1,27 @@
+package etcd
+
+// Tracer is the hook used to integrate the client into distributed
+// tracing, see Client.Tracer. It is shaped after the usual tracing
+// libraries, so that an adapter to any of them is only a few lines,
+// without go-etcd depending on one.
+//
+// A span is started for every attempt to send a request, with the
+// attributes:
+//
+//	http.method	the HTTP method
+//	http.path	the path relative to the API version, e.g. "keys/foo"
+//	etcd.machine	the machine the attempt is sent to
+//	etcd.attempt	the number of the attempt, starting at 1
+//	etcd.request_id	the X-Request-Id, if Client.RequestIDs is set
+//
+// Once the attempt completed, either "http.status_code" or "error" is
+// set on the span before it is ended.
+type Tracer interface {
+	StartSpan(name string, attributes map[string]interface{}) Span
+}
+
+// Span is a single traced operation created by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End()
+}
@@ -0,0 +1,77 @@
+package etcd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) StartSpan(name string, attributes map[string]interface{}) Span {
+	span := &testSpan{name: name, attributes: attributes}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+type testSpan struct {
+	name       string
+	attributes map[string]interface{}
+	ended      bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *testSpan) End() {
+	s.ended = true
+}
+
+func TestTracer(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// fail the first attempt so that the request is retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"action":"get","node":{"key":"/foo","value":"bar"}}`))
+	}))
+	defer ts.Close()
+
+	tracer := new(testTracer)
+	c := NewClient([]string{ts.URL, ts.URL})
+	c.Tracer = tracer
+
+	if _, err := c.Get("foo", false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected a span per attempt, got %v", len(tracer.spans))
+	}
+
+	for i, status := range []int{http.StatusServiceUnavailable, http.StatusOK} {
+		span := tracer.spans[i]
+		if !span.ended {
+			t.Fatalf("span %v was not ended", i)
+		}
+
+		expected := map[string]interface{}{
+			"http.method":      "GET",
+			"http.path":        "keys/foo?consistent=true&recursive=false&sorted=false",
+			"etcd.machine":     ts.URL,
+			"etcd.attempt":     i + 1,
+			"http.status_code": status,
+		}
+		for key, value := range expected {
+			if span.attributes[key] != value {
+				t.Fatalf("span %v has %v = %v, expected %v", i, key, span.attributes[key], value)
+			}
+		}
+	}
+}
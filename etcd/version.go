@@ -1,3 +1,142 @@
 package etcd
 
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
 const version = "v2"
+
+// versionCacheTTL is how long ClusterVersion trusts the version it read.
+const versionCacheTTL = 10 * time.Minute
+
+// Errors introduced by probing the API version
+var (
+	ErrUnsupportedAPIVersion = errors.New("The etcd server does not serve the keys v2 API")
+)
+
+// Version is the version information served under /version.
+type Version struct {
+	Server  string `json:"etcdserver"`
+	Cluster string `json:"etcdcluster"`
+}
+
+// GetVersion returns the version of the first reachable machine.
+func (c *Client) GetVersion() (*Version, error) {
+	var lastErr error
+
+	for _, machine := range c.cluster.Machines {
+		resp, err := c.getURL(c.httpClient, machine, c.createHttpPath(machine, "version"))
+		if err != nil {
+			// try another machine in the cluster
+			lastErr = err
+			continue
+		}
+
+		b, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		// etcd before 2.0 answers with a plain "etcd <version>"
+		if s := strings.TrimSpace(string(b)); strings.HasPrefix(s, "etcd ") {
+			v := strings.TrimPrefix(s, "etcd ")
+			return &Version{Server: v, Cluster: v}, nil
+		}
+
+		v := new(Version)
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+
+	if lastErr == nil {
+		lastErr = newError(ErrCodeEtcdNotReachable, "No machine to ask for the version", 0)
+	}
+	return nil, lastErr
+}
+
+// cachedVersion is the cluster version read by ClusterVersion.
+type cachedVersion struct {
+	version string
+	leader  string
+	expires time.Time
+}
+
+// ClusterVersion returns the version of the cluster, e.g. to enable the
+// features it supports. The version is read with GetVersion once, and
+// cached for ten minutes or until the leader changes, whichever comes
+// first, since an upgrade of the cluster goes along with a new leader.
+// ClusterVersion is cheap enough to be called for every request.
+func (c *Client) ClusterVersion() (string, error) {
+	if cached, _ := c.clusterVersion.Load().(*cachedVersion); cached != nil &&
+		cached.leader == c.cluster.Leader && timeNow().Before(cached.expires) {
+		return cached.version, nil
+	}
+
+	return c.RefreshVersion()
+}
+
+// RefreshVersion reads the version of the cluster anew, and caches it for
+// ClusterVersion.
+func (c *Client) RefreshVersion() (string, error) {
+	leader := c.cluster.Leader
+	v, err := c.GetVersion()
+	if err != nil {
+		return "", err
+	}
+
+	c.clusterVersion.Store(&cachedVersion{
+		version: v.Cluster,
+		leader:  leader,
+		expires: timeNow().Add(versionCacheTTL),
+	})
+	return v.Cluster, nil
+}
+
+// CheckAPIVersion probes the cluster to make sure it serves the keys v2
+// API this client relies upon, and returns ErrUnsupportedAPIVersion
+// otherwise. etcd 3 can be run without the v2 API, in which case every
+// request would otherwise fail with confusing errors.
+func (c *Client) CheckAPIVersion() error {
+	v, err := c.GetVersion()
+	if err != nil {
+		return err
+	}
+
+	if majorVersion(v.Server) < 3 {
+		return nil
+	}
+
+	leader := c.cluster.Leader
+	resp, err := c.getURL(c.httpClient, leader, c.createHttpPath(leader, keyToPath("/")))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// The root directory always exists in the v2 key space
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnsupportedAPIVersion
+	}
+
+	return nil
+}
+
+// majorVersion returns the major number of a version such as "3.4.1",
+// or 0 if it cannot be parsed.
+func majorVersion(v string) int {
+	major, err := strconv.Atoi(strings.SplitN(v, ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
@@ -0,0 +1,87 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckAPIVersion(t *testing.T) {
+	c := NewClient(nil)
+
+	v, err := c.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Server == "" {
+		t.Fatalf("GetVersion failed: %#v", v)
+	}
+
+	if err := c.CheckAPIVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	// etcd 3 with the v2 API disabled
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			w.Write([]byte(`{"etcdserver":"3.4.0","etcdcluster":"3.4.0"}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	c = NewClient([]string{ts.URL})
+	if err := c.CheckAPIVersion(); err != ErrUnsupportedAPIVersion {
+		t.Fatalf("CheckAPIVersion should have detected a v3-only server: %v", err)
+	}
+}
+
+func TestClusterVersion(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprintf(w, `{"etcdserver":"2.3.%v","etcdcluster":"2.%v.0"}`, hits, hits)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	for i := 0; i < 3; i++ {
+		v, err := c.ClusterVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !(v == "2.1.0" && hits == 1) {
+			t.Fatalf("ClusterVersion returned %v after %v requests", v, hits)
+		}
+	}
+
+	v, err := c.RefreshVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(v == "2.2.0" && hits == 2) {
+		t.Fatalf("RefreshVersion returned %v after %v requests", v, hits)
+	}
+
+	// The version is read again once it expired
+	now = now.Add(versionCacheTTL)
+	if v, _ := c.ClusterVersion(); !(v == "2.3.0" && hits == 3) {
+		t.Fatalf("ClusterVersion returned %v after %v requests", v, hits)
+	}
+
+	// or when a new leader is elected
+	c.cluster.updateLeader(ts.URL + "/")
+	if v, _ := c.ClusterVersion(); !(v == "2.4.0" && hits == 4) {
+		t.Fatalf("ClusterVersion returned %v after %v requests", v, hits)
+	}
+}
@@ -0,0 +1,210 @@
+package etcd
+
+import (
+	"fmt"
+	"time"
+)
+
+// WaitForValue blocks until the value of the given key equals expected.
+//
+// If sinceIndex is 0, the current value of the key is checked first and
+// returned immediately if it already matches; a key that does not exist
+// yet is simply treated as not matching. Otherwise changes are watched
+// starting at sinceIndex.
+//
+// If a stop channel is given, the client can abort the wait using the
+// stop channel, in which case ErrWatchStoppedByUser is returned.
+func (c *Client) WaitForValue(key, expected string, sinceIndex uint64,
+	stop chan bool) (*Response, error) {
+
+	waitIndex := sinceIndex
+	if waitIndex == 0 {
+		resp, err := c.read(key, false, false)
+		if err == nil {
+			if !resp.Node.Dir && resp.Node.Value == expected {
+				return resp, nil
+			}
+			waitIndex = resp.EtcdIndex + 1
+		} else if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyNotFound {
+			waitIndex = etcdErr.Index + 1
+		} else {
+			return nil, err
+		}
+	}
+
+	for {
+		resp, err := c.Watch(key, waitIndex, false, nil, stop)
+		if err != nil {
+			return nil, err
+		}
+
+		waitIndex = resp.Node.ModifiedIndex + 1
+		if !isRemovalAction(resp.Action) && resp.Node.Value == expected {
+			return resp, nil
+		}
+	}
+}
+
+// WaitForDelete blocks until the given key is deleted or expires.
+//
+// If sinceIndex is 0, the key is checked first, and nil is returned
+// right away if it does not exist. Otherwise changes are watched starting
+// at sinceIndex.
+//
+// If a stop channel is given, the client can abort the wait using the
+// stop channel, in which case ErrWatchStoppedByUser is returned.
+func (c *Client) WaitForDelete(key string, sinceIndex uint64,
+	stop chan bool) (*Response, error) {
+
+	waitIndex := sinceIndex
+	if waitIndex == 0 {
+		resp, err := c.read(key, false, false)
+		if err == nil {
+			waitIndex = resp.EtcdIndex + 1
+		} else if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyNotFound {
+			return nil, nil
+		} else {
+			return nil, err
+		}
+	}
+
+	for {
+		resp, err := c.Watch(key, waitIndex, false, nil, stop)
+		if err != nil {
+			return nil, err
+		}
+
+		waitIndex = resp.Node.ModifiedIndex + 1
+		if isRemovalAction(resp.Action) {
+			return resp, nil
+		}
+	}
+}
+
+// GetWhenExists gets the given key, waiting for it to be created if it
+// does not exist yet, e.g. by another process starting up at the same
+// time, or gives up after the given timeout.
+func (c *Client) GetWhenExists(key string, timeout time.Duration) (*Response, error) {
+	stop := make(chan bool)
+	timer := time.AfterFunc(timeout, func() {
+		close(stop)
+	})
+	defer timer.Stop()
+
+	for {
+		resp, err := c.read(key, false, false)
+		etcdErr, ok := err.(*EtcdError)
+		if !ok || etcdErr.ErrorCode != ErrCodeKeyNotFound {
+			return resp, err
+		}
+
+		// wait until the key is set, even if it is removed again before
+		// it is read
+		for waitIndex := etcdErr.Index + 1; ; {
+			resp, err = c.Watch(key, waitIndex, false, nil, stop)
+			if err == ErrWatchStoppedByUser {
+				return nil, fmt.Errorf("%v was not created within %v", key, timeout)
+			} else if err != nil {
+				return nil, err
+			}
+
+			waitIndex = resp.Node.ModifiedIndex + 1
+			if !isRemovalAction(resp.Action) {
+				break
+			}
+		}
+	}
+}
+
+// WaitForEmpty blocks until the given directory has no children left, for
+// example once every worker has released its ephemeral key under it. A
+// directory that gets removed altogether counts as empty.
+//
+// If sinceIndex is 0, the directory is checked first, and nil is returned
+// right away if it is already empty. Otherwise changes are watched
+// starting at sinceIndex.
+//
+// If a stop channel is given, the client can abort the wait using the
+// stop channel, in which case ErrWatchStoppedByUser is returned.
+func (c *Client) WaitForEmpty(dir string, sinceIndex uint64, stop chan bool) error {
+	waitIndex := sinceIndex
+	if waitIndex == 0 {
+		empty, index, err := c.isEmptyDir(dir)
+		if err != nil || empty {
+			return err
+		}
+		waitIndex = index + 1
+	}
+
+	for {
+		resp, err := c.Watch(dir, waitIndex, true, nil, stop)
+		if err != nil {
+			return err
+		}
+
+		waitIndex = resp.Node.ModifiedIndex + 1
+		if !isRemovalAction(resp.Action) {
+			continue
+		}
+
+		empty, _, err := c.isEmptyDir(dir)
+		if err != nil || empty {
+			return err
+		}
+	}
+}
+
+// WaitForIndex blocks until the etcd index of the cluster reaches at
+// least the given index, or gives up after the given timeout. A reader
+// can thus make sure to see a write another client made at that index.
+// The index is polled, spaced out like retries, see RetryBackoff.
+func (c *Client) WaitForIndex(index uint64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := c.newBackoff()
+
+	for {
+		current, err := c.CurrentIndex()
+		if err == nil && current >= index {
+			return nil
+		}
+
+		if err != nil {
+			logger.Debug("wait.for.index ", err)
+		}
+		sleep := backoff.next()
+		if time.Now().Add(sleep).After(deadline) {
+			if err != nil {
+				return fmt.Errorf("Index %v not reached within %v: %v", index, timeout, err)
+			}
+			return fmt.Errorf("Index %v not reached within %v, the index is %v", index, timeout, current)
+		}
+		time.Sleep(sleep)
+	}
+}
+
+// isEmptyDir reports whether the given directory has no children, along
+// with the etcd index the answer was read at. A missing directory is
+// empty.
+func (c *Client) isEmptyDir(dir string) (bool, uint64, error) {
+	resp, err := c.read(dir, false, false)
+	if err == nil {
+		if resp.Node.Kind() != DirNode {
+			return false, 0, fmt.Errorf("%v is not a directory", resp.Node.Key)
+		}
+		return len(resp.Node.Nodes) == 0, resp.EtcdIndex, nil
+	}
+
+	if etcdErr, ok := err.(*EtcdError); ok && etcdErr.ErrorCode == ErrCodeKeyNotFound {
+		return true, etcdErr.Index, nil
+	}
+	return false, 0, err
+}
+
+// isRemovalAction reports whether the given action removes a key.
+func isRemovalAction(action string) bool {
+	switch action {
+	case "delete", "compareAndDelete", "expire":
+		return true
+	}
+	return false
+}
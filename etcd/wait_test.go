@@ -0,0 +1,194 @@
+package etcd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWaitForValue(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("wait_foo", true)
+	}()
+
+	c.Delete("wait_foo", true)
+
+	go func() {
+		time.Sleep(time.Second)
+		c.Set("wait_foo", "starting", 100)
+		time.Sleep(time.Second / 10)
+		c.Set("wait_foo", "ready", 100)
+	}()
+
+	resp, err := c.WaitForValue("wait_foo", "ready", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Node.Key == "/wait_foo" && resp.Node.Value == "ready") {
+		t.Fatalf("WaitForValue 1 failed: %#v", resp)
+	}
+	if !(resp.PrevNode != nil && resp.PrevNode.Value == "starting") {
+		t.Fatalf("WaitForValue 1 PrevNode failed: %#v", resp)
+	}
+
+	// The key already holds the expected value, so this should return
+	// without waiting.
+	resp, err = c.WaitForValue("wait_foo", "ready", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "ready" {
+		t.Fatalf("WaitForValue 2 failed: %#v", resp)
+	}
+
+	stop := make(chan bool, 1)
+	stop <- true
+	_, err = c.WaitForValue("wait_foo", "never", 0, stop)
+	if err != ErrWatchStoppedByUser {
+		t.Fatalf("WaitForValue 3 should have been stopped by the user: %v", err)
+	}
+}
+
+func TestWaitForDelete(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("wait_foo", true)
+	}()
+
+	c.Delete("wait_foo", true)
+
+	// The key does not exist, so this should return without waiting.
+	resp, err := c.WaitForDelete("wait_foo", 0, nil)
+	if !(resp == nil && err == nil) {
+		t.Fatalf("WaitForDelete 1 failed: %#v %v", resp, err)
+	}
+
+	c.Set("wait_foo", "locked", 100)
+
+	go func() {
+		time.Sleep(time.Second)
+		c.Set("wait_foo", "still locked", 100)
+		time.Sleep(time.Second / 10)
+		c.Delete("wait_foo", false)
+	}()
+
+	resp, err = c.WaitForDelete("wait_foo", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Action == "delete" && resp.PrevNode.Value == "still locked") {
+		t.Fatalf("WaitForDelete 2 failed: %#v", resp)
+	}
+}
+
+func TestGetWhenExists(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("wait_foo", true)
+	}()
+
+	c.Delete("wait_foo", true)
+
+	go func() {
+		time.Sleep(time.Second / 10)
+		c.Set("wait_foo", "ready", 100)
+	}()
+
+	resp, err := c.GetWhenExists("wait_foo", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(resp.Action == "get" && resp.Node.Value == "ready") {
+		t.Fatalf("GetWhenExists 1 failed: %#v", resp)
+	}
+
+	// The key exists, so this should return without waiting.
+	start := time.Now()
+	resp, err = c.GetWhenExists("wait_foo", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "ready" || time.Since(start) > time.Second {
+		t.Fatalf("GetWhenExists 2 failed: %#v", resp)
+	}
+
+	if _, err := c.GetWhenExists("wait_missing", time.Second/10); err == nil {
+		t.Fatal("GetWhenExists should time out on a missing key")
+	}
+}
+
+func TestWaitForEmpty(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("wait_workers", true)
+	}()
+
+	c.Delete("wait_workers", true)
+
+	// The directory does not exist, so this should return without waiting.
+	if err := c.WaitForEmpty("wait_workers", 0, nil); err != nil {
+		t.Fatalf("WaitForEmpty 1 failed: %v", err)
+	}
+
+	c.Set("wait_workers/a", "busy", 100)
+	c.Set("wait_workers/b", "busy", 100)
+
+	deleted := make(chan bool, 1)
+	go func() {
+		time.Sleep(time.Second)
+		c.Delete("wait_workers/a", false)
+		time.Sleep(time.Second / 10)
+		deleted <- true
+		c.Delete("wait_workers/b", false)
+	}()
+
+	if err := c.WaitForEmpty("wait_workers", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-deleted:
+	default:
+		t.Fatal("WaitForEmpty 2 returned before the last child was deleted")
+	}
+
+	resp, err := c.Get("wait_workers", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Node.Nodes) != 0 {
+		t.Fatalf("WaitForEmpty 2 failed: %#v", resp.Node)
+	}
+}
+
+func TestWaitForIndex(t *testing.T) {
+	// Every request sees the index of the cluster one step further
+	var index uint64 = 10
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		index++
+		w.Header().Set("X-Etcd-Index", fmt.Sprint(index))
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.RetryBackoff = time.Millisecond
+
+	if err := c.WaitForIndex(15, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if index != 15 {
+		t.Fatalf("WaitForIndex returned at index %v, expected 15", index)
+	}
+
+	// An index already reached returns right away
+	if err := c.WaitForIndex(5, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.WaitForIndex(1000, 0); err == nil {
+		t.Fatal("WaitForIndex should time out before the index is reached")
+	}
+}
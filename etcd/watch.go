@@ -1,12 +1,16 @@
 package etcd
 
 import (
+	"encoding/json"
 	"errors"
+	"sync"
+	"time"
 )
 
 // Errors introduced by the Watch command.
 var (
 	ErrWatchStoppedByUser = errors.New("Watch stopped by the user via stop channel")
+	ErrWatchTimedOut      = errors.New("Watch timed out on the server without a change")
 )
 
 // If recursive is set to true the watch returns the first change under the given
@@ -21,36 +25,36 @@ var (
 //channel. After someone receives the channel, it will go on to watch that
 // prefix.  If a stop channel is given, the client can close long-term watch using
 // the stop channel.
+//
+// A long-term watch reconnects when the cluster cannot be reached or the
+// connection is cut off, waiting between reconnections as described by
+// Client.RetryBackoff. Any watch which times out on the server without a
+// change is sent again right away.
 func (c *Client) Watch(prefix string, waitIndex uint64, recursive bool,
 	receiver chan *Response, stop chan bool) (*Response, error) {
 	logger.Debugf("watch %s [%s]", prefix, c.cluster.Leader)
 	if receiver == nil {
-		raw, err := c.watchOnce(prefix, waitIndex, recursive, stop)
+		for {
+			raw, err := c.watchOnce(prefix, waitIndex, recursive, stop)
 
-		if err != nil {
-			return nil, err
-		}
+			if err != nil {
+				return nil, err
+			}
 
-		return raw.Unmarshal()
+			resp, err := raw.Unmarshal()
+			if err != ErrWatchTimedOut {
+				return resp, err
+			}
+			logger.Debug("watch.timed.out, watching again ", prefix)
+		}
 	}
 	defer close(receiver)
 
-	for {
-		raw, err := c.watchOnce(prefix, waitIndex, recursive, stop)
-
-		if err != nil {
-			return nil, err
-		}
-
-		resp, err := raw.Unmarshal()
-
-		if err != nil {
-			return nil, err
-		}
-
-		waitIndex = resp.Node.ModifiedIndex + 1
-		receiver <- resp
-	}
+	_, err := c.watchLoop(prefix, waitIndex, recursive, stop,
+		func(resp *Response, raw *RawResponse) {
+			receiver <- resp
+		})
+	return nil, err
 }
 
 func (c *Client) RawWatch(prefix string, waitIndex uint64, recursive bool,
@@ -61,24 +65,107 @@ func (c *Client) RawWatch(prefix string, waitIndex uint64, recursive bool,
 		return c.watchOnce(prefix, waitIndex, recursive, stop)
 	}
 
-	for {
-		raw, err := c.watchOnce(prefix, waitIndex, recursive, stop)
+	_, err := c.watchLoop(prefix, waitIndex, recursive, stop,
+		func(resp *Response, raw *RawResponse) {
+			receiver <- raw
+		})
+	return nil, err
+}
+
+// WatchWithToken is like Watch, except that the watch is described by a
+// WatchToken and an updated token is returned along with the result.
+// Persisting the returned token allows a restarted process to resume
+// the watch exactly where it left off.
+//
+// For a long-term watch, the returned token points right after the last
+// response handed to the receiver.
+func (c *Client) WatchWithToken(token WatchToken, receiver chan *Response,
+	stop chan bool) (*Response, WatchToken, error) {
 
+	logger.Debugf("watchWithToken %s [%s]", token.Prefix, c.cluster.Leader)
+	if receiver == nil {
+		resp, err := c.Watch(token.Prefix, token.WaitIndex, token.Recursive, nil, stop)
 		if err != nil {
-			return nil, err
+			return nil, token, err
 		}
+		return resp, token.Next(resp), nil
+	}
+	defer close(receiver)
+
+	waitIndex, err := c.watchLoop(token.Prefix, token.WaitIndex, token.Recursive, stop,
+		func(resp *Response, raw *RawResponse) {
+			receiver <- resp
+		})
+	token.WaitIndex = waitIndex
+	return nil, token, err
+}
 
-		resp, err := raw.Unmarshal()
+// watchLoop keeps watching the given prefix and hands every change to
+// deliver, until the watch fails or is stopped. It returns the index to
+// resume the watch from along with the error that ended it.
+func (c *Client) watchLoop(prefix string, waitIndex uint64, recursive bool,
+	stop chan bool, deliver func(*Response, *RawResponse)) (uint64, error) {
 
+	backoff := c.newBackoff()
+	for {
+		raw, err := c.watchOnce(prefix, waitIndex, recursive, stop)
+
+		var resp *Response
+		if err == nil {
+			resp, err = raw.Unmarshal()
+		}
+
+		if err == ErrWatchTimedOut {
+			logger.Debug("watch.timed.out, watching again ", prefix)
+			continue
+		}
 		if err != nil {
-			return nil, err
+			if err = c.waitToReconnect(err, backoff, stop); err != nil {
+				return waitIndex, err
+			}
+			continue
 		}
 
+		backoff = c.newBackoff()
+		deliver(resp, raw)
 		waitIndex = resp.Node.ModifiedIndex + 1
-		receiver <- raw
 	}
 }
 
+// waitToReconnect decides whether a long-term watch can survive the given
+// error. If the error is transient, it waits for the next backoff delay
+// and returns nil so that the watch reconnects. Otherwise, or if the
+// watch is stopped in the meantime, the error to return is given back.
+func (c *Client) waitToReconnect(err error, backoff *backoff, stop chan bool) error {
+	if !isTransientWatchError(err) {
+		return err
+	}
+
+	sleep := backoff.next()
+	logger.Debugf("watch.reconnect in %v: %v", sleep, err)
+
+	select {
+	case <-stop:
+		return ErrWatchStoppedByUser
+	case <-time.After(sleep):
+		return nil
+	}
+}
+
+// isTransientWatchError reports whether a watch failed because the
+// cluster could not be reached or the connection was cut off, rather
+// than because etcd rejected it.
+func isTransientWatchError(err error) bool {
+	switch err := err.(type) {
+	case *EtcdError:
+		return err.ErrorCode == ErrCodeEtcdNotReachable
+	case *json.SyntaxError:
+		// an empty or truncated body
+		return true
+	}
+	return false
+}
+
 // helper func
 // return when there is change under the given prefix
 func (c *Client) watchOnce(key string, waitIndex uint64, recursive bool, stop chan bool) (*RawResponse, error) {
@@ -101,3 +188,180 @@ func (c *Client) watchOnce(key string, waitIndex uint64, recursive bool, stop ch
 
 	return resp, err
 }
+
+// CollectChanges watches the given prefix, recursively, for the given
+// window of time, starting from the current index, and returns all the
+// changes seen meanwhile, in order, e.g. to sample the rate of changes.
+// If the watch fails before the window ends, the changes seen so far are
+// returned along with the error.
+func (c *Client) CollectChanges(prefix string, window time.Duration) ([]*Response, error) {
+	index, err := c.CurrentIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	stop := make(chan bool)
+	timer := time.AfterFunc(window, func() {
+		close(stop)
+	})
+	defer timer.Stop()
+
+	var changes []*Response
+	_, err = c.watchLoop(prefix, index+1, true, stop,
+		func(resp *Response, raw *RawResponse) {
+			changes = append(changes, resp)
+		})
+	if err == ErrWatchStoppedByUser {
+		err = nil
+	}
+	return changes, err
+}
+
+// PrefixEvent is a change seen by WatchMulti under one of its prefixes.
+// If the watch of the prefix failed, Err is set instead of Response, and
+// no more events follow for the prefix.
+type PrefixEvent struct {
+	Prefix   string
+	Response *Response
+	Err      error
+}
+
+// WatchMulti watches each of the given prefixes, recursively, starting
+// from the current index, and sends the changes under any of them to the
+// returned channel, tagged with their prefix. Each watch reconnects like
+// a long-term Watch. Closing the stop channel ends all of them, after
+// which the returned channel is closed.
+func (c *Client) WatchMulti(prefixes []string, stop chan bool) (chan PrefixEvent, error) {
+	index, err := c.CurrentIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan PrefixEvent)
+	var wg sync.WaitGroup
+	for _, prefix := range prefixes {
+		wg.Add(1)
+		go func(prefix string) {
+			defer wg.Done()
+
+			_, err := c.watchLoop(prefix, index+1, true, stop,
+				func(resp *Response, raw *RawResponse) {
+					select {
+					case events <- PrefixEvent{Prefix: prefix, Response: resp}:
+					case <-stop:
+					}
+				})
+			if err != ErrWatchStoppedByUser {
+				select {
+				case events <- PrefixEvent{Prefix: prefix, Err: err}:
+				case <-stop:
+				}
+			}
+		}(prefix)
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// WatchDebounced watches the given key from the current index and sends
+// a change to the returned channel only once the key has been left alone
+// for the quiet duration, so that a burst of changes is delivered as its
+// last one. The watch reconnects like a long-term Watch. The channel is
+// closed once the stop channel is closed or the watch fails, in which
+// case any change still waiting out the quiet duration is sent first.
+// Use WatchDebouncedWithErrors to learn why the watch failed.
+func (c *Client) WatchDebounced(key string, quiet time.Duration, stop chan bool) (chan *Response, error) {
+	changes, errs, err := c.WatchDebouncedWithErrors(key, quiet, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := <-errs; err != nil {
+			logger.Warningf("watch.debounced %s failed: %v", key, err)
+		}
+	}()
+	return changes, nil
+}
+
+// WatchDebouncedWithErrors is WatchDebounced, but also returns an error
+// channel, as StreamTree does. It receives at most one error, after the
+// change channel was closed, if the watch failed, and is closed in turn.
+// The change channel must be drained.
+func (c *Client) WatchDebouncedWithErrors(key string, quiet time.Duration, stop chan bool) (chan *Response, chan error, error) {
+	index, err := c.CurrentIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := make(chan *Response)
+	failed := make(chan error, 1)
+	go func() {
+		defer close(changes)
+
+		_, err := c.watchLoop(key, index+1, false, stop,
+			func(resp *Response, raw *RawResponse) {
+				select {
+				case changes <- resp:
+				case <-stop:
+				}
+			})
+		if err != ErrWatchStoppedByUser {
+			failed <- err
+		}
+	}()
+
+	debounced := make(chan *Response)
+	errs := make(chan error, 1)
+	send := func(resp *Response) bool {
+		select {
+		case debounced <- resp:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	go func() {
+		var failure error
+		defer func() {
+			close(debounced)
+			if failure != nil {
+				errs <- failure
+			}
+			close(errs)
+		}()
+
+		var latest *Response
+		var settled <-chan time.Time
+		for {
+			select {
+			case resp, ok := <-changes:
+				if !ok {
+					if settled != nil && !send(latest) {
+						return
+					}
+					select {
+					case failure = <-failed:
+					default:
+					}
+					return
+				}
+				latest = resp
+				settled = time.After(quiet)
+
+			case <-settled:
+				settled = nil
+				if !send(latest) {
+					return
+				}
+			}
+		}
+	}()
+
+	return debounced, errs, nil
+}
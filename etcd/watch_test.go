@@ -2,7 +2,11 @@ package etcd
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 )
@@ -97,6 +101,62 @@ func TestWatchAll(t *testing.T) {
 	}
 }
 
+func TestWatchReconnectBackoff(t *testing.T) {
+	var lock sync.Mutex
+	var attempts []time.Time
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts = append(attempts, time.Now())
+		n := len(attempts)
+		lock.Unlock()
+
+		switch {
+		case n <= 3:
+			// cut the connection off without any response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case n == 4:
+			w.Write([]byte(`{"action":"set","node":{"key":"/foo","value":"bar","modifiedIndex":7}}`))
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+	c.RetryBackoff = 50 * time.Millisecond
+	// every reconnection is a single request
+	c.MaxRetries = -1
+
+	ch := make(chan *Response, 1)
+	stop := make(chan bool, 1)
+	go func() {
+		<-ch
+		stop <- true
+	}()
+
+	_, err := c.Watch("foo", 0, false, ch, stop)
+	if err != ErrWatchStoppedByUser {
+		t.Fatalf("Watch returned a non-user stop error: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(attempts) < 4 {
+		t.Fatalf("expected at least 4 attempts, got %v", len(attempts))
+	}
+
+	expected := c.RetryBackoff
+	for i := 1; i < 4; i++ {
+		if gap := attempts[i].Sub(attempts[i-1]); gap < expected {
+			t.Fatalf("reconnect %v happened after %v, expected at least %v", i, gap, expected)
+		}
+		expected *= 2
+	}
+}
+
 func setHelper(key, value string, c *Client) {
 	time.Sleep(time.Second)
 	c.Set(key, value, 100)
@@ -117,3 +177,235 @@ func receiver(c chan *Response, stop chan bool) {
 	}
 	stop <- true
 }
+
+func TestWatchTimedOut(t *testing.T) {
+	var lock sync.Mutex
+	var waitIndexes []string
+
+	// every other watch times out on the server, with an empty body
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		waitIndexes = append(waitIndexes, r.URL.Query().Get("waitIndex"))
+		n := len(waitIndexes)
+		lock.Unlock()
+
+		w.Header().Set("X-Etcd-Index", "7")
+		if n%2 == 1 {
+			return
+		}
+		fmt.Fprintf(w, `{"action":"set","node":{"key":"/foo","value":"%v","modifiedIndex":%v}}`, n, n+6)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	resp, err := c.Watch("foo", 7, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "2" {
+		t.Fatalf("Watch returned %v, expected the change after the timeout", resp.Node.Value)
+	}
+
+	// Raw watches leave the empty response to the caller
+	raw, err := c.RawWatch("foo", 7, false, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := raw.Unmarshal(); err != ErrWatchTimedOut {
+		t.Fatalf("Unmarshal of a timed out watch returned %v, expected ErrWatchTimedOut", err)
+	}
+
+	ch := make(chan *Response)
+	stop := make(chan bool)
+	go func() {
+		c.Watch("foo", 9, false, ch, stop)
+	}()
+	for _, expected := range []string{"4", "6"} {
+		select {
+		case resp := <-ch:
+			if resp.Node.Value != expected {
+				t.Fatalf("Watch sent %v, expected %v", resp.Node.Value, expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for the watch")
+		}
+	}
+	close(stop)
+
+	// the timed out watches are sent again from the same index
+	lock.Lock()
+	defer lock.Unlock()
+	expected := []string{"7", "7", "7", "9", "11", "11"}
+	if !reflect.DeepEqual(waitIndexes[:6], expected) {
+		t.Fatalf("the watches were sent with waitIndex %q, expected %q", waitIndexes, expected)
+	}
+}
+
+func TestCollectChanges(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("collect_foo", true)
+	}()
+
+	c.Delete("collect_foo", true)
+	// This change happens before the window
+	c.Set("collect_foo/before", "0", 5)
+
+	go func() {
+		time.Sleep(time.Second / 10)
+		c.Set("collect_foo/a", "1", 5)
+		c.Set("collect_foo/dir/b", "2", 5)
+		c.Delete("collect_foo/a", false)
+	}()
+
+	start := time.Now()
+	changes, err := c.CollectChanges("collect_foo", time.Second/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second/2 {
+		t.Fatalf("CollectChanges returned after %v, before the window ended", elapsed)
+	}
+
+	var seen []string
+	for _, resp := range changes {
+		seen = append(seen, resp.Action+" "+resp.Node.Key)
+	}
+	expected := []string{"set /collect_foo/a", "set /collect_foo/dir/b", "delete /collect_foo/a"}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Fatalf("CollectChanges returned %q, expected %q", seen, expected)
+	}
+}
+
+func TestWatchMulti(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("multi_foo", true)
+		c.Delete("multi_bar", true)
+		c.Delete("multi_baz", false)
+	}()
+
+	stop := make(chan bool)
+	events, err := c.WatchMulti([]string{"multi_foo", "multi_bar"}, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Set("multi_foo/a", "1", 5)
+	c.Set("multi_bar/b", "2", 5)
+	c.Set("multi_baz", "3", 5)
+
+	seen := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		select {
+		case ev := <-events:
+			if ev.Err != nil {
+				t.Fatalf("WatchMulti failed for %v: %v", ev.Prefix, ev.Err)
+			}
+			seen[ev.Response.Node.Key] = ev.Prefix
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timed out waiting for WatchMulti events, got %v", seen)
+		}
+	}
+
+	expected := map[string]string{"/multi_foo/a": "multi_foo", "/multi_bar/b": "multi_bar"}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Fatalf("WatchMulti tagged events %v, expected %v", seen, expected)
+	}
+
+	close(stop)
+	select {
+	case ev, ok := <-events:
+		if ok {
+			t.Fatalf("WatchMulti sent %v after being stopped", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WatchMulti channel was not closed after stop")
+	}
+}
+
+func TestWatchDebounced(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("debounced_foo", true)
+	}()
+
+	stop := make(chan bool)
+	changes, err := c.WatchDebounced("debounced_foo", time.Second/4, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"1", "2", "3"} {
+		c.Set("debounced_foo", value, 5)
+	}
+
+	select {
+	case resp := <-changes:
+		if resp.Node.Value != "3" {
+			t.Fatalf("WatchDebounced sent %v, expected the final value 3", resp.Node.Value)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for WatchDebounced")
+	}
+
+	select {
+	case resp := <-changes:
+		t.Fatalf("WatchDebounced sent %v after the burst", resp.Node.Value)
+	case <-time.After(time.Second / 2):
+	}
+
+	close(stop)
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Fatal("WatchDebounced sent a change after being stopped")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WatchDebounced channel was not closed after stop")
+	}
+}
+
+func TestWatchDebouncedFailure(t *testing.T) {
+	var watches int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Etcd-Index", "7")
+		if r.Method == "HEAD" {
+			return
+		}
+
+		// one change, then the history has been cleared
+		watches++
+		if watches == 1 {
+			fmt.Fprint(w, `{"action":"set","node":{"key":"/foo","value":"1","modifiedIndex":8}}`)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"errorCode":401,"message":"The event in requested index is outdated and cleared","index":7}`)
+	}))
+	defer ts.Close()
+
+	c := NewClient([]string{ts.URL})
+
+	changes, errs, err := c.WatchDebouncedWithErrors("foo", time.Minute, make(chan bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the change still waiting out the quiet duration comes first
+	var values []string
+	for resp := range changes {
+		values = append(values, resp.Node.Value)
+	}
+	if len(values) != 1 || values[0] != "1" {
+		t.Fatalf("WatchDebounced sent %v, expected the pending change", values)
+	}
+	err = <-errs
+	if etcdErr, ok := err.(*EtcdError); !ok || etcdErr.ErrorCode != ErrCodeEventIndexCleared {
+		t.Fatalf("WatchDebounced failed with %v, expected the cleared index", err)
+	}
+	if _, ok := <-errs; ok {
+		t.Fatal("the error channel was not closed")
+	}
+}
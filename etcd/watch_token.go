@@ -0,0 +1,65 @@
+package etcd
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// WatchToken describes the position of a watch, so that it can be
+// persisted and resumed later on, see Client.WatchWithToken.
+type WatchToken struct {
+	Prefix    string
+	Recursive bool
+	// WaitIndex is the index of the next change to watch for.
+	WaitIndex uint64
+}
+
+// NewWatchToken returns a WatchToken for a new watch. As with Watch,
+// waitIndex = 0 watches for the latest change.
+func NewWatchToken(prefix string, waitIndex uint64, recursive bool) WatchToken {
+	return WatchToken{
+		Prefix:    prefix,
+		Recursive: recursive,
+		WaitIndex: waitIndex,
+	}
+}
+
+// Next returns the token to resume the watch from after the given
+// response was received.
+func (t WatchToken) Next(resp *Response) WatchToken {
+	t.WaitIndex = resp.Node.ModifiedIndex + 1
+	return t
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (t WatchToken) MarshalText() ([]byte, error) {
+	v := url.Values{}
+	v.Set("prefix", t.Prefix)
+	v.Set("recursive", strconv.FormatBool(t.Recursive))
+	v.Set("waitIndex", strconv.FormatUint(t.WaitIndex, 10))
+	return []byte(v.Encode()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (t *WatchToken) UnmarshalText(text []byte) error {
+	v, err := url.ParseQuery(string(text))
+	if err != nil {
+		return err
+	}
+
+	recursive, err := strconv.ParseBool(v.Get("recursive"))
+	if err != nil {
+		return fmt.Errorf("Invalid watch token %q: %v", text, err)
+	}
+
+	waitIndex, err := strconv.ParseUint(v.Get("waitIndex"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid watch token %q: %v", text, err)
+	}
+
+	t.Prefix = v.Get("prefix")
+	t.Recursive = recursive
+	t.WaitIndex = waitIndex
+	return nil
+}
@@ -0,0 +1,80 @@
+package etcd
+
+import (
+	"testing"
+)
+
+func TestWatchToken(t *testing.T) {
+	c := NewClient(nil)
+	defer func() {
+		c.Delete("watch_token", true)
+	}()
+
+	resp, err := c.Set("watch_token", "v0", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := NewWatchToken("watch_token", resp.Node.ModifiedIndex+1, false)
+
+	c.Set("watch_token", "v1", 100)
+	c.Set("watch_token", "v2", 100)
+
+	resp, token, err = c.WatchWithToken(token, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "v1" {
+		t.Fatalf("WatchWithToken 1 failed: %#v", resp)
+	}
+
+	// Persist the token and resume from it, as a restarted process would
+	text, err := token.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resumed WatchToken
+	if err := resumed.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if resumed != token {
+		t.Fatalf("token did not round-trip: %#v != %#v", resumed, token)
+	}
+
+	c2 := NewClient(nil)
+	resp, resumed, err = c2.WatchWithToken(resumed, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Node.Value != "v2" {
+		t.Fatalf("WatchWithToken 2 failed: %#v", resp)
+	}
+
+	// A long-term watch returns the token following the last response
+	c.Set("watch_token", "v3", 100)
+
+	ch := make(chan *Response)
+	stop := make(chan bool, 1)
+	go func() {
+		<-ch
+		stop <- true
+	}()
+
+	_, resumed, err = c2.WatchWithToken(resumed, ch, stop)
+	if err != ErrWatchStoppedByUser {
+		t.Fatalf("WatchWithToken returned a non-user stop error: %v", err)
+	}
+
+	resp, err = c.Get("watch_token", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.WaitIndex != resp.Node.ModifiedIndex+1 {
+		t.Fatalf("WatchWithToken 3 returned %v, expected %v",
+			resumed.WaitIndex, resp.Node.ModifiedIndex+1)
+	}
+
+	if err := resumed.UnmarshalText([]byte("prefix=foo")); err == nil {
+		t.Fatal("should not be able to unmarshal an incomplete token")
+	}
+}